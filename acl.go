@@ -0,0 +1,80 @@
+package notifier
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// checkACL reports an error if the access control rules of c are invalid.
+func (c *Config) checkACL() error {
+	for id, globs := range c.ACL {
+		if err := checkIdentity(id); err != nil {
+			return err
+		}
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("identity %q: invalid pattern %q", id, glob)
+			}
+		}
+	}
+	return nil
+}
+
+// checkIdentity reports an error if id is not a valid identity for access
+// control rules.
+func checkIdentity(id string) error {
+	if id == "*" {
+		return nil
+	}
+	kind, name, ok := strings.Cut(id, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid identity %q", id)
+	}
+	switch kind {
+	case "token", "tls", "remote":
+	case "uid":
+		if _, err := strconv.Atoi(name); err != nil {
+			return fmt.Errorf("identity %q: invalid uid", id)
+		}
+	default:
+		return fmt.Errorf("identity %q: unknown kind %q", id, kind)
+	}
+	return nil
+}
+
+// identities returns the identities of p that may be named in the access
+// control rules of a configuration.
+func (p Peer) identities() []string {
+	ids := []string{"*"}
+	if p.Token != "" {
+		ids = append(ids, "token:"+p.Token)
+	}
+	if p.TLSSubject != "" {
+		ids = append(ids, "tls:"+p.TLSSubject)
+	}
+	if p.Cred != nil {
+		ids = append(ids, "uid:"+strconv.Itoa(p.Cred.UID))
+	}
+	if p.Network == "remote" {
+		ids = append(ids, "remote:"+p.Address)
+	}
+	return ids
+}
+
+// aclAllows reports whether the rules in acl permit p to call method.  If acl
+// is empty, all methods are permitted.
+func aclAllows(acl map[string][]string, p Peer, method string) bool {
+	if len(acl) == 0 {
+		return true
+	}
+	for _, id := range p.identities() {
+		for _, glob := range acl[id] {
+			if ok, _ := path.Match(glob, method); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package notifier
+
+import "testing"
+
+func TestACLAllows(t *testing.T) {
+	acl := map[string][]string{
+		"*":             {"Notify.Post"},
+		"token:alice":   {"Clip.*"},
+		"tls:build":     {"Notify.*"},
+		"uid:1000":      {"User.Text"},
+		"remote:host:1": {"Clip.Get"},
+	}
+	tests := []struct {
+		name   string
+		peer   Peer
+		method string
+		want   bool
+	}{
+		{"Anyone", Peer{}, "Notify.Post", true},
+		{"AnyoneDenied", Peer{}, "Clip.Get", false},
+		{"Token", Peer{Token: "alice"}, "Clip.Set", true},
+		{"TokenGlob", Peer{Token: "alice"}, "Notify.Say", false},
+		{"OtherToken", Peer{Token: "bob"}, "Clip.Set", false},
+		{"TLS", Peer{TLSSubject: "build"}, "Notify.Say", true},
+		{"UID", Peer{Cred: &PeerCred{UID: 1000}}, "User.Text", true},
+		{"OtherUID", Peer{Cred: &PeerCred{UID: 1001}}, "User.Text", false},
+		{"Remote", Peer{Network: "remote", Address: "host:1"}, "Clip.Get", true},
+		{"NotRemote", Peer{Network: "tcp", Address: "host:1"}, "Clip.Get", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := aclAllows(acl, tc.peer, tc.method); got != tc.want {
+				t.Errorf("aclAllows(%v, %q): got %v, want %v", tc.peer, tc.method, got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		if !aclAllows(nil, Peer{}, "User.Edit") {
+			t.Error("aclAllows: an empty ACL should permit all methods")
+		}
+	})
+}
+
+func TestCheckACL(t *testing.T) {
+	tests := []struct {
+		id, glob string
+		ok       bool
+	}{
+		{"*", "*", true},
+		{"token:alice", "Clip.*", true},
+		{"tls:build.example.com", "Notify.Post", true},
+		{"uid:1000", "*", true},
+		{"remote:host:9010", "*", true},
+		{"uid:alice", "*", false},
+		{"alice", "*", false},
+		{"token:", "*", false},
+		{"group:staff", "*", false},
+		{"token:alice", "Clip.[", false},
+	}
+	for _, tc := range tests {
+		cfg := &Config{ACL: map[string][]string{tc.id: {tc.glob}}}
+		if err := cfg.checkACL(); (err == nil) != tc.ok {
+			t.Errorf("checkACL(%q: %q): got error %v, want ok=%v", tc.id, tc.glob, err, tc.ok)
+		}
+	}
+}
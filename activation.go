@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/jrpc2"
+)
+
+// listenFDStart is the first file descriptor passed by socket activation.
+// It is a variable so that tests can pass descriptors of their own.
+var listenFDStart = 3
+
+// An inheritedListener is a listener passed to the process by systemd socket
+// activation.
+type inheritedListener struct {
+	name string // from LISTEN_FDNAMES, if set
+	ln   net.Listener
+}
+
+// activationListeners returns the listeners passed to the process by systemd
+// socket activation, as described by sd_listen_fds(3). It returns no
+// listeners if the environment does not pass any to this process. The
+// environment variables are cleared so that they are not inherited by
+// subprocesses.
+func activationListeners() ([]*inheritedListener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	var out []*inheritedListener
+	for i := range n {
+		fd := listenFDStart + i
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, il := range out {
+				il.ln.Close()
+			}
+			return nil, fmt.Errorf("inherited fd %d: %w", fd, err)
+		}
+		out = append(out, &inheritedListener{name: name, ln: ln})
+	}
+	return out, nil
+}
+
+// matches reports whether il is the listener for the configured address
+// addr. It matches if the name of il is addr, or if il is listening on addr.
+// For TCP, the host and port of addr are resolved before comparing them, so
+// that for example ":8080" matches a listener on "[::]:8080", and
+// "localhost:8080" matches a listener on "127.0.0.1:8080".
+func (il *inheritedListener) matches(addr string) bool {
+	if il.name == addr {
+		return true
+	}
+	atype, addr := jrpc2.Network(addr)
+	la := il.ln.Addr()
+	if la.Network() != atype {
+		return false
+	} else if ta, ok := la.(*net.TCPAddr); ok {
+		return tcpMatches(ta, addr)
+	} else if atype == "unix" {
+		addr = os.ExpandEnv(addr)
+	}
+	return la.String() == addr
+}
+
+// tcpMatches reports whether la is the address of a listener on the TCP
+// address addr. An unspecified host matches any unspecified address, and a
+// host name matches each of the addresses it resolves to.
+func tcpMatches(la *net.TCPAddr, addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	} else if p, err := net.LookupPort("tcp", port); err != nil || p != la.Port {
+		return false
+	}
+	if host == "" {
+		return la.IP.IsUnspecified()
+	} else if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(la.IP) || (ip.IsUnspecified() && la.IP.IsUnspecified())
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(ips, la.IP.Equal)
+}
@@ -0,0 +1,121 @@
+//go:build unix
+
+package notifier
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMatches(t *testing.T) {
+	listen := func(network, addr string) net.Listener {
+		t.Helper()
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			t.Skipf("Listen %s %q: %v", network, addr, err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		return ln
+	}
+	any4 := listen("tcp4", "0.0.0.0:0")
+	loop4 := listen("tcp4", "127.0.0.1:0")
+	sock := filepath.Join(t.TempDir(), "test.sock")
+	unixln := listen("unix", sock)
+	port := func(ln net.Listener) string { return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port) }
+
+	tests := []struct {
+		name string
+		il   *inheritedListener
+		addr string
+		want bool
+	}{
+		{"Name", &inheritedListener{name: "main", ln: loop4}, "main", true},
+		{"Exact", &inheritedListener{ln: loop4}, loop4.Addr().String(), true},
+		{"Localhost", &inheritedListener{ln: loop4}, "localhost:" + port(loop4), true},
+		{"WrongPort", &inheritedListener{ln: loop4}, "127.0.0.1:1", false},
+		{"WrongHost", &inheritedListener{ln: loop4}, "127.0.0.2:" + port(loop4), false},
+		{"NotWildcard", &inheritedListener{ln: loop4}, ":" + port(loop4), false},
+		{"EmptyHost", &inheritedListener{ln: any4}, ":" + port(any4), true},
+		{"Unspecified4", &inheritedListener{ln: any4}, "0.0.0.0:" + port(any4), true},
+		{"Unspecified6", &inheritedListener{ln: any4}, "[::]:" + port(any4), true},
+		{"NotLoopback", &inheritedListener{ln: any4}, "127.0.0.1:" + port(any4), false},
+		{"Socket", &inheritedListener{ln: unixln}, sock, true},
+		{"OtherSocket", &inheritedListener{ln: unixln}, sock + ".x", false},
+		{"SocketNotTCP", &inheritedListener{ln: unixln}, "127.0.0.1:" + port(loop4), false},
+	}
+	for _, tc := range tests {
+		if got := tc.il.matches(tc.addr); got != tc.want {
+			t.Errorf("%s: matches(%q) on %v: got %v, want %v", tc.name, tc.addr, tc.il.ln.Addr(), got, tc.want)
+		}
+	}
+}
+
+func TestActivationListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer tcp.Close()
+	sock, err := net.Listen("unix", filepath.Join(t.TempDir(), "test.sock"))
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer sock.Close()
+
+	// Pass copies of the listeners at consecutive descriptors, as systemd
+	// does, starting above any descriptor the test is likely to be using.
+	const start = 200
+	for i, ln := range []net.Listener{tcp, sock} {
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatalf("File: %v", err)
+		}
+		err = unix.Dup2(int(f.Fd()), start+i)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Dup2: %v", err)
+		}
+	}
+	defer func(old int) { listenFDStart = old }(listenFDStart)
+	listenFDStart = start
+
+	t.Run("OtherProcess", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+		t.Setenv("LISTEN_FDS", "2")
+		if got, err := activationListeners(); err != nil || len(got) != 0 {
+			t.Errorf("activationListeners: got %d listeners, %v; want none", len(got), err)
+		}
+	})
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "web")
+	got, err := activationListeners()
+	if err != nil {
+		t.Fatalf("activationListeners: %v", err)
+	}
+	for _, il := range got {
+		defer il.ln.Close()
+	}
+	if len(got) != 2 {
+		t.Fatalf("activationListeners: got %d listeners, want 2", len(got))
+	}
+	if got[0].name != "web" || got[1].name != "" {
+		t.Errorf("Names: got %q, %q; want %q, %q", got[0].name, got[1].name, "web", "")
+	}
+	for i, want := range []net.Listener{tcp, sock} {
+		if g, w := got[i].ln.Addr().String(), want.Addr().String(); g != w {
+			t.Errorf("Listener %d: got address %q, want %q", i, g, w)
+		}
+	}
+	for _, v := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if val, ok := os.LookupEnv(v); ok {
+			t.Errorf("Environment %s=%q was not cleared", v, val)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/creachadair/atomicfile"
+)
+
+// A Clipboard is a backend that stores the contents of the system clipboard.
+type Clipboard interface {
+	// GetClipboard returns the current contents of the clipboard.
+	GetClipboard(ctx context.Context) ([]byte, error)
+
+	// SetClipboard replaces the contents of the clipboard with data.
+	// Setting empty data clears the clipboard.
+	SetClipboard(ctx context.Context, data []byte) error
+}
+
+// Clipboard returns the clipboard backend selected by the configuration.  If
+// c.Clip.Clipboard is set, it is returned; otherwise a new backend is created
+// as specified by c.Clip.Backend.
+func (c *Config) Clipboard() (Clipboard, error) {
+	if c.Clip.Clipboard != nil {
+		return c.Clip.Clipboard, nil
+	}
+	switch c.Clip.Backend {
+	case "", "pbcopy":
+		return PasteboardClipboard, nil
+	case "xclip":
+		return commandClipboard{
+			get: []string{"xclip", "-selection", "clipboard", "-o"},
+			set: []string{"xclip", "-selection", "clipboard", "-i"},
+		}, nil
+	case "xsel":
+		return commandClipboard{
+			get: []string{"xsel", "--clipboard", "--output"},
+			set: []string{"xsel", "--clipboard", "--input"},
+		}, nil
+	case "wl-clipboard":
+		return commandClipboard{
+			get: []string{"wl-paste", "--no-newline"},
+			set: []string{"wl-copy"},
+		}, nil
+	case "file":
+		if c.Clip.File == "" {
+			return nil, fmt.Errorf("clipboard backend %q requires a file path", c.Clip.Backend)
+		}
+		return FileClipboard(os.ExpandEnv(c.Clip.File)), nil
+	case "memory":
+		return new(MemoryClipboard), nil
+	default:
+		return nil, fmt.Errorf("unknown clipboard backend %q", c.Clip.Backend)
+	}
+}
+
+// PasteboardClipboard is a Clipboard that uses the macOS general pasteboard
+// via the pbcopy and pbpaste commands.
+var PasteboardClipboard Clipboard = commandClipboard{
+	get: []string{"pbpaste", "-pboard", "general"},
+	set: []string{"pbcopy", "-pboard", "general"},
+}
+
+// commandClipboard implements the Clipboard interface by running a command to
+// read or write the clipboard contents on stdout and stdin respectively.
+type commandClipboard struct {
+	get, set []string
+}
+
+func (c commandClipboard) GetClipboard(ctx context.Context) ([]byte, error) {
+	return exec.CommandContext(ctx, c.get[0], c.get[1:]...).Output()
+}
+
+func (c commandClipboard) SetClipboard(ctx context.Context, data []byte) error {
+	cmd := exec.CommandContext(ctx, c.set[0], c.set[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	return cmd.Run()
+}
+
+// FileClipboard is a Clipboard that stores its contents in the named file.
+// Reading the clipboard when the file does not exist reports empty data.
+type FileClipboard string
+
+// GetClipboard implements part of the Clipboard interface.
+func (f FileClipboard) GetClipboard(context.Context) ([]byte, error) {
+	data, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// SetClipboard implements part of the Clipboard interface.
+func (f FileClipboard) SetClipboard(_ context.Context, data []byte) error {
+	return atomicfile.WriteData(string(f), data, 0600)
+}
+
+// MemoryClipboard is a Clipboard that stores its contents in memory.
+// The zero value is ready for use and is empty.
+type MemoryClipboard struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// GetClipboard implements part of the Clipboard interface.
+func (m *MemoryClipboard) GetClipboard(context.Context) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return bytes.Clone(m.data), nil
+}
+
+// SetClipboard implements part of the Clipboard interface.
+func (m *MemoryClipboard) SetClipboard(_ context.Context, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = bytes.Clone(data)
+	return nil
+}
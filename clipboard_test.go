@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigClipboard(t *testing.T) {
+	mem := new(MemoryClipboard)
+	tests := []struct {
+		name, backend, file string
+		ok                  bool
+	}{
+		{"Default", "", "", true},
+		{"xclip", "xclip", "", true},
+		{"xsel", "xsel", "", true},
+		{"wl-clipboard", "wl-clipboard", "", true},
+		{"File", "file", "/tmp/clip", true},
+		{"FileNoPath", "file", "", false},
+		{"Memory", "memory", "", true},
+		{"Unknown", "bogus", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Clip.Backend, cfg.Clip.File = tc.backend, tc.file
+			cb, err := cfg.Clipboard()
+			if (err == nil) != tc.ok {
+				t.Fatalf("Clipboard: got error %v, want ok=%v", err, tc.ok)
+			} else if err == nil && cb == nil {
+				t.Error("Clipboard: got nil backend")
+			}
+		})
+	}
+
+	t.Run("ExplicitUsed", func(t *testing.T) {
+		// A configured backend is used regardless of the backend name.
+		var cfg Config
+		cfg.Clip.Backend, cfg.Clip.Clipboard = "bogus", mem
+		cb, err := cfg.Clipboard()
+		if err != nil || cb != mem {
+			t.Errorf("Clipboard: got (%v, %v), want the configured backend", cb, err)
+		}
+	})
+}
+
+func TestClipboardBackends(t *testing.T) {
+	ctx := context.Background()
+	for name, cb := range map[string]Clipboard{
+		"File":   FileClipboard(filepath.Join(t.TempDir(), "clip")),
+		"Memory": new(MemoryClipboard),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if data, err := cb.GetClipboard(ctx); err != nil || len(data) != 0 {
+				t.Errorf("Get empty: got (%q, %v), want empty", data, err)
+			}
+			if err := cb.SetClipboard(ctx, []byte("hello")); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if data, err := cb.GetClipboard(ctx); err != nil || string(data) != "hello" {
+				t.Errorf("Get: got (%q, %v), want %q", data, err, "hello")
+			}
+			if err := cb.SetClipboard(ctx, nil); err != nil {
+				t.Fatalf("Clear: %v", err)
+			}
+			if data, err := cb.GetClipboard(ctx); err != nil || len(data) != 0 {
+				t.Errorf("Get cleared: got (%q, %v), want empty", data, err)
+			}
+		})
+	}
+}
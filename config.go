@@ -1,9 +1,16 @@
 package notifier
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
 
 	"bitbucket.org/creachadair/shell"
 	yaml "gopkg.in/yaml.v3"
@@ -14,22 +21,255 @@ type Config struct {
 	Address  string
 	DebugLog bool `yaml:"debugLog"`
 
+	// Additional addresses to listen on. The server listens on Address, if
+	// it is set, and on each of these. The settings for each address default
+	// to the top-level settings below.
+	Listen []*ListenConfig
+
+	// If set, the server speaks HTTP on Address rather than line-delimited
+	// JSON-RPC. JSON-RPC requests may be POSTed to /rpc, or sent over a
+	// WebSocket connected to /ws. The server also provides REST endpoints for
+	// notifications (/notify, /say) and clips (/clip/{tag}, /clips).
+	HTTP *HTTPConfig `yaml:"http"`
+
+	// Remote endpoints for the server to connect to. The server dials each
+	// of these, and serves a session on each connection as if the remote
+	// endpoint were a client. A lost connection is redialed with backoff.
+	// The client has the identity "remote:ADDRESS" for access control. The
+	// top-level Auth and ACL settings do not apply to these sessions; each
+	// remote endpoint has its own, as described by DialConfig.
+	Dial []*DialConfig
+
+	// If set, calls to the selected services are forwarded to another server
+	// rather than handled by this one. Each forwarded call records this
+	// server as a hop; see ForwardRequest.
+	Upstream *UpstreamConfig
+
+	// The name of this server in the hops recorded for forwarded calls. A
+	// server rejects a forwarded call that has already passed through a
+	// server with its name. If empty, the host name is used, with a random
+	// suffix chosen when the server starts.
+	Name string
+
+	// The identities of the clients that may forward calls to this server,
+	// in the form used by ACL, for example "tls:edge" or "token:relay". A
+	// forwarded call is subject to the access control rules that apply to the
+	// client that forwarded it.
+	Downstream []string
+
+	// Settings for the socket, when Address is a Unix-domain socket.
+	Socket SocketConfig
+
+	// Settings for TLS. If CertFile and KeyFile are set, the server accepts
+	// only TLS connections on Address.
+	TLS TLSConfig
+
+	// Settings for client authentication. If any tokens are defined, a client
+	// must authenticate with one of them before calling any methods other than
+	// those of the Session service, unless it presented a verified TLS client
+	// certificate.
+	Auth AuthConfig
+
+	// Access control rules, mapping client identities to the methods they may
+	// call. Each method is a glob, for example "Notify.*" or "Clip.Get".  An
+	// identity is "token:NAME" for a client that authenticated with the token
+	// named NAME, "tls:NAME" for a client whose TLS certificate has name NAME
+	// (its common name, or if that is empty its first DNS name, email address,
+	// or URI, or its full subject), "uid:N" for a client connected over a
+	// Unix-domain socket as user ID N, "remote:ADDRESS" for the remote
+	// endpoint dialed at ADDRESS, or "*" for any client. If any rules are
+	// defined, a client may call only methods allowed for one of its
+	// identities. Methods of the Session service are always allowed.
+	ACL map[string][]string `yaml:"acl"`
+
+	// Settings for individual plugins, keyed by plugin name. These may be
+	// used to disable a plugin, including the built-in ones, and to provide
+	// settings to plugins that do not have a section of their own.
+	Plugins map[string]*PluginConfig
+
 	// Settings for the clipboard service.
 	Clip struct {
 		SaveFile string `yaml:"saveFile"`
+
+		// The clipboard backend to use: pbcopy (default), xclip, xsel,
+		// wl-clipboard, file, or memory.
+		Backend string
+
+		// The file used to store the clipboard for the "file" backend.
+		File string
+
+		// If set, this clipboard is used regardless of Backend.
+		Clipboard Clipboard `yaml:"-"`
 	}
 
 	// Settings for the editor service.
 	Edit struct {
 		Command  string
 		TouchNew bool `yaml:"touchNew"`
+
+		// If set, this editor is used instead of Command.
+		Editor Editor `yaml:"-"`
+	}
+
+	// Settings for the user input service.
+	User struct {
+		// The dialog backend to use: osascript (default), zenity, kdialog,
+		// or terminal.
+		Backend string
+
+		// If set, this dialog is used regardless of Backend.
+		Dialog Dialog `yaml:"-"`
 	}
 
 	// Settings for the notification service.
 	Notify struct {
 		Sound string
 		Voice string
+
+		// The notification backend to use: osascript (default), notify-send,
+		// or log.
+		Backend string
+
+		// The file to which the "log" backend appends notifications.
+		// If empty, notifications are written to the server log.
+		LogFile string `yaml:"logFile"`
+
+		// If set, this poster is used regardless of Backend.
+		Poster Poster `yaml:"-"`
+
+		// The speech backend to use: say (default), espeak-ng, festival,
+		// piper, or command.
+		SpeechBackend string `yaml:"speechBackend"`
+
+		// The command line for the "command" speech backend. The text is
+		// written to its stdin, and "{voice}" in an argument is replaced by
+		// the voice name. Setting this selects the "command" backend if no
+		// other backend is specified.
+		SpeechCommand string `yaml:"speechCommand"`
+
+		// Maps requested voice names to backend-specific voice names.
+		// The piper backend speaks only with the models named here.
+		Voices map[string]string
+
+		// If set, this speaker is used regardless of SpeechBackend.
+		Speaker Speaker `yaml:"-"`
+	}
+}
+
+// A ListenConfig describes an additional address for the server to listen
+// on. Each setting that is not nil replaces the top-level setting of the same
+// name for connections to this address.
+type ListenConfig struct {
+	Address string
+
+	HTTP   *HTTPConfig `yaml:"http"`
+	Socket *SocketConfig
+	TLS    *TLSConfig
+	Auth   *AuthConfig
+	ACL    map[string][]string `yaml:"acl"`
+}
+
+// HTTPConfig is the settings for a listener that speaks HTTP.
+type HTTPConfig struct {
+	// Origins from which browsers may send requests, for example
+	// "chrome-extension://abcdef". Requests that do not include an Origin
+	// header are not affected.
+	AllowOrigins []string `yaml:"allowOrigins"`
+
+	// Host names, other than loopback addresses and "localhost", by which
+	// clients may address the server, for example "notes.example.com".
+	// Requests over TCP whose Host header names any other host are rejected,
+	// so that a web page cannot reach the server by rebinding its host name.
+	AllowHosts []string `yaml:"allowHosts"`
+}
+
+// SocketConfig is the settings for a Unix-domain socket. An abstract socket,
+// whose name begins with "@", has no file, so Mode and Group do not apply.
+type SocketConfig struct {
+	// The permission bits of the socket, in octal, for example "0660".
+	// If empty, the socket has the default permissions of the process.
+	Mode string
+
+	// The name or ID of the group that owns the socket. If empty, the
+	// group is not changed.
+	Group string
+
+	// If set, only clients running as one of these user IDs, or as the same
+	// user as the server, may connect. Connections are rejected if the
+	// platform does not report the credentials of the client.
+	AllowUIDs []int `yaml:"allowUIDs"`
+}
+
+// TLSConfig is the TLS settings for a listener.
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// If set, clients must present a certificate signed by one of the
+	// certificate authorities in this file.
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// AuthConfig is the client authentication settings for a listener.
+type AuthConfig struct {
+	// Tokens accepted by the server, keyed by a name for the client.
+	Tokens map[string]string `notifier:"secret"`
+
+	// A file of additional tokens, in the format described by AuthTokens.
+	TokenFile string `yaml:"tokenFile"`
+}
+
+// listenConfigs returns a configuration for each address the server listens
+// on, in which the top-level settings are replaced by those of the address.
+func (c *Config) listenConfigs() []*Config {
+	var out []*Config
+	if c.Address != "" {
+		out = append(out, c)
+	}
+	for _, lc := range c.Listen {
+		if lc != nil {
+			out = append(out, c.overlay(lc))
+		}
+	}
+	return out
+}
+
+// listenerConfig returns the configuration for the listener at addr, or nil
+// if c does not define a listener at addr. The empty address denotes a listener
+// that was not defined by the configuration, which uses the top-level settings.
+func (c *Config) listenerConfig(addr string) *Config {
+	if addr == "" || addr == c.Address {
+		return c
 	}
+	for _, lc := range c.Listen {
+		if lc != nil && lc.Address == addr {
+			return c.overlay(lc)
+		}
+	}
+	return nil
+}
+
+// overlay returns a copy of c with its address and listener settings replaced
+// by those set in lc.
+func (c *Config) overlay(lc *ListenConfig) *Config {
+	cp := *c
+	cp.Address = lc.Address
+	if lc.HTTP != nil {
+		cp.HTTP = lc.HTTP
+	}
+	if lc.Socket != nil {
+		cp.Socket = *lc.Socket
+	}
+	if lc.TLS != nil {
+		cp.TLS = *lc.TLS
+	}
+	if lc.Auth != nil {
+		cp.Auth = *lc.Auth
+	}
+	if lc.ACL != nil {
+		cp.ACL = lc.ACL
+	}
+	return &cp
 }
 
 // LoadConfig loads a configuration from the file at path into *cfg.
@@ -47,8 +287,243 @@ func LoadConfig(path string, cfg *Config) error {
 	return dec.Decode(cfg)
 }
 
+// An Editor is a backend that lets the user edit the contents of a file.
+type Editor interface {
+	// EditFile edits the file at path, returning when editing is complete.
+	EditFile(ctx context.Context, path string) error
+}
+
+// Validate reports an error if c is not a valid configuration.  In particular,
+// it checks that each of the backends selected by c can be constructed.
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := c.Clipboard(); err != nil {
+		errs = append(errs, fmt.Errorf("clip: %w", err))
+	}
+	if _, err := c.Poster(); err != nil {
+		errs = append(errs, fmt.Errorf("notify: %w", err))
+	}
+	if _, err := c.Speaker(); err != nil {
+		errs = append(errs, fmt.Errorf("notify: %w", err))
+	}
+	if _, err := c.Dialog(); err != nil {
+		errs = append(errs, fmt.Errorf("user: %w", err))
+	}
+	errs = append(errs, c.checkListener()...)
+	seen := map[string]bool{c.Address: c.Address != ""}
+	for i, lc := range c.Listen {
+		if lc == nil || lc.Address == "" {
+			errs = append(errs, fmt.Errorf("listen %d: missing address", i+1))
+			continue
+		} else if seen[lc.Address] {
+			errs = append(errs, fmt.Errorf("listen %d: duplicate address %q", i+1, lc.Address))
+		}
+		seen[lc.Address] = true
+		for _, err := range c.overlay(lc).checkListener() {
+			errs = append(errs, fmt.Errorf("listen %q: %w", lc.Address, err))
+		}
+	}
+	for name, pc := range c.Plugins {
+		if pc != nil && pc.Command != "" {
+			if _, err := pluginCommand(c, name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for i, dc := range c.Dial {
+		if dc == nil {
+			errs = append(errs, fmt.Errorf("dial %d: missing settings", i+1))
+		} else if err := dc.check(); err != nil {
+			errs = append(errs, fmt.Errorf("dial %d: %w", i+1, err))
+		}
+	}
+	if c.Upstream != nil {
+		if err := c.Upstream.check(); err != nil {
+			errs = append(errs, fmt.Errorf("upstream: %w", err))
+		}
+	}
+	for _, id := range c.Downstream {
+		if err := checkIdentity(id); err != nil {
+			errs = append(errs, fmt.Errorf("downstream: %w", err))
+		}
+	}
+	if c.Edit.Command != "" {
+		if args, ok := shell.Split(c.Edit.Command); !ok || len(args) == 0 {
+			errs = append(errs, fmt.Errorf("edit: invalid command %q", c.Edit.Command))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkListener reports errors in the settings of c that apply to the
+// connections of a listener.
+func (c *Config) checkListener() []error {
+	var errs []error
+	if _, _, err := c.socketPerms(); err != nil {
+		errs = append(errs, fmt.Errorf("socket: %w", err))
+	}
+	if _, err := c.ServerTLS(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %w", err))
+	}
+	if _, err := c.AuthTokens(); err != nil {
+		errs = append(errs, fmt.Errorf("auth: %w", err))
+	}
+	if err := c.checkACL(); err != nil {
+		errs = append(errs, fmt.Errorf("acl: %w", err))
+	}
+	return errs
+}
+
+// Diff returns a human-readable description of each setting that differs
+// between c and other, in the format "Section.Name: old → new".  Settings
+// that are not loaded from the configuration file are not compared. The values
+// of secrets and plugin settings are not shown.
+func (c *Config) Diff(other *Config) []string {
+	var diffs []string
+	var walk func(path string, a, b reflect.Value)
+	walk = func(path string, a, b reflect.Value) {
+		switch {
+		case a.Type() == reflect.TypeFor[yaml.Node]():
+			// Plugin settings may contain secrets, so their values are not shown.
+			if nodeString(a) != nodeString(b) {
+				diffs = append(diffs, path+": changed (value hidden)")
+			}
+
+		case a.Kind() == reflect.Struct:
+			for i := range a.NumField() {
+				f := a.Type().Field(i)
+				if !f.IsExported() || f.Tag.Get("yaml") == "-" {
+					continue
+				}
+				name := f.Name
+				if path != "" {
+					name = path + "." + name
+				}
+				if f.Tag.Get("notifier") == "secret" {
+					if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+						diffs = append(diffs, name+": changed (value hidden)")
+					}
+					continue
+				}
+				walk(name, a.Field(i), b.Field(i))
+			}
+
+		case a.Kind() == reflect.Pointer && !a.IsNil() && !b.IsNil():
+			walk(path, a.Elem(), b.Elem())
+
+		case a.Kind() == reflect.Pointer && a.Type().Elem().Kind() == reflect.Struct && a.IsNil() != b.IsNil():
+			if a.IsNil() {
+				diffs = append(diffs, path+": added")
+			} else {
+				diffs = append(diffs, path+": removed")
+			}
+
+		case a.Kind() == reflect.Slice && a.Type().Elem().Kind() == reflect.Pointer:
+			for i := range max(a.Len(), b.Len()) {
+				name := fmt.Sprintf("%s[%d]", path, i)
+				if i >= a.Len() {
+					diffs = append(diffs, name+": added")
+				} else if i >= b.Len() {
+					diffs = append(diffs, name+": removed")
+				} else {
+					walk(name, a.Index(i), b.Index(i))
+				}
+			}
+
+		case a.Kind() == reflect.Map && a.Type().Key().Kind() == reflect.String:
+			keys := make(map[string]bool)
+			for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+				keys[k.String()] = true
+			}
+			for _, key := range slices.Sorted(maps.Keys(keys)) {
+				k := reflect.ValueOf(key).Convert(a.Type().Key())
+				va, vb := a.MapIndex(k), b.MapIndex(k)
+				name := fmt.Sprintf("%s[%q]", path, key)
+				if !va.IsValid() {
+					diffs = append(diffs, name+": added")
+				} else if !vb.IsValid() {
+					diffs = append(diffs, name+": removed")
+				} else {
+					walk(name, va, vb)
+				}
+			}
+
+		default:
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				diffs = append(diffs, fmt.Sprintf("%s: %s → %s", path, valueString(a), valueString(b)))
+			}
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem())
+	return diffs
+}
+
+func valueString(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+func nodeString(v reflect.Value) string {
+	if v.FieldByName("Kind").IsZero() {
+		return "<empty>"
+	}
+	node := v.Interface().(yaml.Node)
+	node.Style |= yaml.FlowStyle
+	bits, err := yaml.Marshal(&node)
+	if err != nil {
+		return "<invalid>"
+	}
+	return strings.TrimSpace(string(bits))
+}
+
+// A PluginConfig holds the settings for a single plugin.
+type PluginConfig struct {
+	// Whether the plugin is enabled. Plugins are enabled by default.
+	Enabled *bool
+
+	// Plugin-specific settings, decoded by the plugin during Init using the
+	// PluginSettings method of Config.
+	Settings yaml.Node
+
+	// If set, the plugin is an external program run with this command line.
+	// The program must serve JSON-RPC on its stdin and stdout, one message
+	// per line. Its methods are exported under the name of the plugin.
+	Command string
+}
+
+// PluginEnabled reports whether the named plugin is enabled by c.
+func (c *Config) PluginEnabled(name string) bool {
+	pc, ok := c.Plugins[name]
+	return !ok || pc == nil || pc.Enabled == nil || *pc.Enabled
+}
+
+// PluginSettings decodes the settings for the named plugin into v, which must
+// be a pointer. Unknown fields are reported as errors. If c has no settings
+// for the plugin, v is not modified.
+func (c *Config) PluginSettings(name string, v any) error {
+	pc, ok := c.Plugins[name]
+	if !ok || pc == nil || pc.Settings.Kind == 0 {
+		return nil
+	}
+	bits, err := yaml.Marshal(&pc.Settings)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bits))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("plugin %q settings: %w", name, err)
+	}
+	return nil
+}
+
 // EditFile edits a file using the editor specified by c.
 func (c *Config) EditFile(ctx context.Context, path string) error {
+	if c.Edit.Editor != nil {
+		return c.Edit.Editor.EditFile(ctx, path)
+	}
 	cmd, err := c.EditFileCmd(ctx, path)
 	if err != nil {
 		return err
@@ -66,7 +541,10 @@ func (c *Config) EditFileCmd(ctx context.Context, path string) (*exec.Cmd, error
 		}
 		f.Close()
 	}
-	args, _ := shell.Split(c.Edit.Command)
+	args, ok := shell.Split(c.Edit.Command)
+	if !ok || len(args) == 0 {
+		return nil, fmt.Errorf("invalid editor command %q", c.Edit.Command)
+	}
 	bin, rest := args[0], args[1:]
 	return exec.CommandContext(ctx, bin, append(rest, path)...), nil
 }
@@ -0,0 +1,197 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// Bounds on the delay before redialing a remote endpoint after a failed or
+// lost connection. If a connection lasts for at least maxRedialDelay, the
+// delay is reset.
+const (
+	minRedialDelay = 1 * time.Second
+	maxRedialDelay = 1 * time.Minute
+)
+
+// A DialConfig describes a remote endpoint for the server to connect to.
+type DialConfig struct {
+	// The address of the remote endpoint, host:port for TCP or the path of a
+	// Unix-domain socket.
+	Address string
+
+	// If set, the connection uses TLS with these settings.
+	TLS *ClientTLSConfig
+
+	// If set, the server sends this token to the remote endpoint when it
+	// connects, so that the endpoint can verify the server. The token is sent
+	// as a Session.Auth notification, before the session begins.
+	Token string `notifier:"secret"`
+
+	// If set, the remote endpoint must authenticate with one of these tokens
+	// before calling methods other than those of the Session service.
+	Auth *AuthConfig
+
+	// Access control rules for sessions on this connection, in the same form
+	// as the top-level ACL. If neither Auth nor ACL is set, the remote
+	// endpoint may call only the methods of the Notify service.
+	ACL map[string][]string `yaml:"acl"`
+}
+
+// defaultDialACL is the access control rule for a dialed connection whose
+// settings do not include authentication or access rules.
+var defaultDialACL = map[string][]string{"*": {"Notify.*"}}
+
+// ClientTLSConfig is the TLS settings for a client connection.
+type ClientTLSConfig struct {
+	// Verify the server with the certificate authorities in this file. If
+	// empty, the system roots are used.
+	CAFile string `yaml:"caFile"`
+
+	// Present this client certificate and key. If KeyFile is empty, the key
+	// is read from CertFile.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// The expected name of the server. If empty, the host of the address is
+	// used.
+	ServerName string `yaml:"serverName"`
+}
+
+// check reports an error if the settings of dc are invalid.
+func (dc *DialConfig) check() error {
+	if dc.Address == "" {
+		return errors.New("missing address")
+	}
+	if dc.TLS != nil {
+		if _, err := dc.TLS.config(dc.Address); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	sc := dc.settings()
+	if _, err := sc.AuthTokens(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	} else if err := sc.checkACL(); err != nil {
+		return fmt.Errorf("acl: %w", err)
+	}
+	return nil
+}
+
+// settings returns the authentication and access settings of dc as a Config.
+func (dc *DialConfig) settings() *Config {
+	cfg := &Config{ACL: dc.ACL}
+	if dc.Auth != nil {
+		cfg.Auth = *dc.Auth
+	} else if dc.ACL == nil {
+		cfg.ACL = defaultDialACL
+	}
+	return cfg
+}
+
+// dialLoop connects to the remote endpoint ep and serves a session on the
+// connection, redialing with backoff whenever the connection fails or is
+// lost, until s is shut down, ep is removed, or ctx ends. The caller must add
+// to s.serving before calling dialLoop.
+func (s *Server) dialLoop(ctx context.Context, ep *endpoint) {
+	defer s.serving.Done()
+	dc := ep.dial
+
+	// Dialing stops when s is closed, but sessions may continue while the
+	// server drains, so only the dial uses this context.
+	dctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-dctx.Done():
+		}
+	}()
+
+	delay := minRedialDelay
+	for {
+		start := time.Now()
+		conn, err := dialRemote(dctx, dc)
+		if err == nil && dc.Token != "" {
+			if err = sendToken(conn, dc.Token); err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("Dialing remote %q failed: %v", dc.Address, err)
+		} else {
+			log.Printf("Connected to remote %q", dc.Address)
+			peer := Peer{Network: "remote", Address: dc.Address}
+			srv := s.serveConn(ctx, channel.Line(conn, conn), &session{peer: peer, ep: ep})
+			if srv == nil {
+				return // the server is closed, or ep was removed while dialing
+			}
+			err := srv.Wait()
+			log.Printf("Connection to remote %q ended (%v)", dc.Address, err)
+			if time.Since(start) >= maxRedialDelay {
+				delay = minRedialDelay
+			}
+		}
+
+		if s.policy(ep).removed {
+			log.Printf("Remote %q was removed; no longer dialing it", dc.Address)
+			return
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRedialDelay)
+	}
+}
+
+// sendToken sends a Session.Auth notification for token to w.
+func sendToken(w io.Writer, token string) error {
+	msg, err := json.Marshal(struct {
+		V      string       `json:"jsonrpc"`
+		Method string       `json:"method"`
+		Params *AuthRequest `json:"params"`
+	}{V: "2.0", Method: "Session.Auth", Params: &AuthRequest{Token: token}})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(msg, '\n'))
+	return err
+}
+
+// dialRemote connects to the remote endpoint described by dc.
+func dialRemote(ctx context.Context, dc *DialConfig) (net.Conn, error) {
+	atype, addr := jrpc2.Network(dc.Address)
+	if atype == "unix" {
+		addr = os.ExpandEnv(addr)
+	}
+	var tc *tls.Config
+	if dc.TLS != nil {
+		var err error
+		tc, err = dc.TLS.config(addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if tc != nil {
+		d := &tls.Dialer{Config: tc}
+		return d.DialContext(dctx, atype, addr)
+	}
+	var d net.Dialer
+	return d.DialContext(dctx, atype, addr)
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestDialEmptyTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Record the first byte sent by the client, which begins a TLS handshake
+	// record if the client speaks TLS.
+	first := make(chan byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(first)
+			return
+		}
+		defer conn.Close()
+		var buf [1]byte
+		if _, err := conn.Read(buf[:]); err == nil {
+			first <- buf[0]
+		}
+		close(first)
+	}()
+
+	dc := &DialConfig{Address: ln.Addr().String(), TLS: &ClientTLSConfig{}}
+	if err := dc.check(); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if conn, err := dialRemote(context.Background(), dc); err == nil {
+		conn.Close()
+		t.Error("Dial: unexpectedly succeeded without a TLS server")
+	}
+	const recordTypeHandshake = 0x16
+	if b, ok := <-first; !ok || b != recordTypeHandshake {
+		t.Errorf("First byte from client: got %#x (ok=%v), want %#x", b, ok, recordTypeHandshake)
+	}
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	cfg, err := ClientTLSConfig{}.config("build.example.com:9010")
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	if cfg == nil {
+		t.Fatal("Config: got nil, want TLS settings")
+	}
+	if cfg.ServerName != "build.example.com" {
+		t.Errorf("ServerName: got %q, want %q", cfg.ServerName, "build.example.com")
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion: got %#x, want %#x", cfg.MinVersion, tls.VersionTLS12)
+	}
+
+	if _, err := (ClientTLSConfig{KeyFile: "client.key"}).config("host:1"); err == nil {
+		t.Error("Config: key without certificate: got nil error, want an error")
+	}
+}
@@ -0,0 +1,208 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creachadair/jrpc2"
+	"golang.org/x/term"
+)
+
+// A Dialog is a backend that prompts the user for a string of text.
+type Dialog interface {
+	// PromptText displays req.Prompt and returns the text entered by the user.
+	// If the user cancels the request, PromptText must report an error with
+	// code UserCancelled.
+	PromptText(ctx context.Context, req *TextRequest) (string, error)
+}
+
+// Dialog returns the dialog backend selected by the configuration.  If
+// c.User.Dialog is set, it is returned; otherwise a new backend is created as
+// specified by c.User.Backend.
+func (c *Config) Dialog() (Dialog, error) {
+	if c.User.Dialog != nil {
+		return c.User.Dialog, nil
+	}
+	switch c.User.Backend {
+	case "", "osascript":
+		return osaDialog{}, nil
+	case "zenity":
+		return zenityDialog{}, nil
+	case "kdialog":
+		return kdialogDialog{}, nil
+	case "terminal":
+		return terminalDialog{}, nil
+	default:
+		return nil, fmt.Errorf("unknown dialog backend %q", c.User.Backend)
+	}
+}
+
+// errUserCancelled is the error reported by dialog backends when the user
+// cancels a request.
+var errUserCancelled = jrpc2.Errorf(UserCancelled, "user cancelled request")
+
+// osaDialog prompts the user via the AppleScript "display dialog" command.
+type osaDialog struct{}
+
+func (osaDialog) PromptText(ctx context.Context, req *TextRequest) (string, error) {
+	// Ask osascript to send error text to stdout to simplify error plumbing.
+	cmd := exec.CommandContext(ctx, "osascript", "-s", "ho")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf(`display dialog %q default answer %q hidden answer %v`,
+		req.Prompt, req.Default, req.Hide))
+	raw, err := cmd.Output()
+	out := strings.TrimRight(string(raw), "\n")
+	if err != nil {
+		if strings.Contains(out, "User canceled") {
+			return "", errUserCancelled
+		}
+		return "", err
+	}
+
+	// Parse the result out of the text delivered to stdout.
+	const needle = "text returned:"
+	if _, after, ok := strings.Cut(out, needle); ok {
+		return after, nil
+	}
+	return "", jrpc2.Errorf(jrpc2.InternalError, "missing user input")
+}
+
+// zenityDialog prompts the user with a GTK dialog via zenity.
+type zenityDialog struct{}
+
+func (zenityDialog) PromptText(ctx context.Context, req *TextRequest) (string, error) {
+	args := []string{"--entry", "--title=noteserver", "--text=" + req.Prompt, "--entry-text=" + req.Default}
+	if req.Hide {
+		args = append(args, "--hide-text")
+	}
+	return runDialog(exec.CommandContext(ctx, "zenity", args...))
+}
+
+// kdialogDialog prompts the user with a KDE dialog via kdialog.
+type kdialogDialog struct{}
+
+func (kdialogDialog) PromptText(ctx context.Context, req *TextRequest) (string, error) {
+	// The password dialog does not support a default answer.
+	args := []string{"--title", "noteserver", "--inputbox", req.Prompt, req.Default}
+	if req.Hide {
+		args = []string{"--title", "noteserver", "--password", req.Prompt}
+	}
+	return runDialog(exec.CommandContext(ctx, "kdialog", args...))
+}
+
+// runDialog runs a dialog command that prints the user's input to stdout and
+// exits with status 1 if the user cancels the dialog.
+func runDialog(cmd *exec.Cmd) (string, error) {
+	out, err := cmd.Output()
+	var xerr *exec.ExitError
+	if errors.As(err, &xerr) && xerr.ExitCode() == 1 {
+		return "", errUserCancelled
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// terminalDialog prompts the user on the controlling terminal of the server.
+// An empty response selects the default, and end-of-input cancels.
+type terminalDialog struct{}
+
+func (terminalDialog) PromptText(ctx context.Context, req *TextRequest) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	// A read deadline unblocks a pending read if ctx ends first. The terminal
+	// is not closed until the read has returned, so that its descriptor is not
+	// reused while the read is in progress.
+	stop := context.AfterFunc(ctx, func() { tty.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	prompt := req.Prompt
+	if req.Default != "" && !req.Hide {
+		prompt += " [" + req.Default + "]"
+	}
+	fmt.Fprint(tty, prompt+": ")
+
+	var text string
+	if req.Hide {
+		line, err := readHidden(tty)
+		fmt.Fprintln(tty)
+		if err != nil {
+			return "", terminalError(ctx, err)
+		}
+		text = line
+	} else {
+		line, err := bufio.NewReader(tty).ReadString('\n')
+		if err != nil {
+			return "", terminalError(ctx, err)
+		}
+		text = strings.TrimSuffix(line, "\n")
+	}
+	if text == "" {
+		return req.Default, nil
+	}
+	return text, nil
+}
+
+// readHidden reads a line from tty without echoing it. Unlike
+// term.ReadPassword, it reads through tty rather than its descriptor, so that
+// a read deadline set on tty interrupts it.
+func readHidden(tty *os.File) (string, error) {
+	rc, err := tty.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	var state *term.State
+	if cerr := rc.Control(func(fd uintptr) { state, err = term.MakeRaw(int(fd)) }); cerr != nil {
+		return "", cerr
+	} else if err != nil {
+		return "", err
+	}
+	defer rc.Control(func(fd uintptr) { term.Restore(int(fd), state) })
+
+	// The terminal is in raw mode, so the line is edited here.
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := tty.Read(buf); err != nil {
+			return "", err
+		}
+		switch c := buf[0]; c {
+		case '\r', '\n':
+			return string(line), nil
+		case 0x7f, '\b': // erase
+			_, n := utf8.DecodeLastRune(line)
+			line = line[:len(line)-n]
+		case 0x15: // kill
+			line = line[:0]
+		case 0x03: // interrupt
+			return "", errUserCancelled
+		case 0x04: // end of input
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		default:
+			line = append(line, c)
+		}
+	}
+}
+
+// terminalError translates an error reading from the terminal.
+func terminalError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err == io.EOF {
+		return errUserCancelled
+	}
+	return err
+}
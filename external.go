@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"bitbucket.org/creachadair/shell"
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/jrpc2/handler"
+)
+
+// Bounds on the delay before restarting an external plugin that has exited.
+// If a plugin runs for at least maxRestartDelay, the delay is reset.
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 1 * time.Minute
+)
+
+// discoveryTimeout bounds the time allowed for an external plugin to report
+// its methods when it is started.
+const discoveryTimeout = 10 * time.Second
+
+// externalPlugin is a Plugin whose methods are served by a subprocess that
+// speaks line-delimited JSON-RPC on its stdin and stdout. The methods are
+// discovered by calling rpc.serverInfo when the plugin starts. If the
+// subprocess exits, it is restarted after a delay.
+type externalPlugin struct {
+	name    string
+	methods []string
+
+	mu      sync.Mutex
+	command []string
+	cmd     *exec.Cmd
+	cli     *jrpc2.Client
+	stop    chan struct{} // closed when the plugin is shut down
+	done    chan struct{} // closed when the monitor exits
+}
+
+func newExternalPlugin(name string) *externalPlugin {
+	return &externalPlugin{
+		name: name,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func pluginCommand(cfg *Config, name string) ([]string, error) {
+	pc := cfg.Plugins[name]
+	if pc == nil || pc.Command == "" {
+		return nil, fmt.Errorf("no command for plugin %q", name)
+	}
+	args, ok := shell.Split(pc.Command)
+	if !ok || len(args) == 0 {
+		return nil, fmt.Errorf("invalid command for plugin %q: %q", name, pc.Command)
+	}
+	return args, nil
+}
+
+// Init implements part of Plugin. It starts the subprocess and discovers the
+// methods it exports.
+func (e *externalPlugin) Init(cfg *Config) error {
+	args, err := pluginCommand(cfg, e.name)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.command = args
+	if err := e.startLocked(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	var info jrpc2.ServerInfo
+	if err := e.cli.CallResult(ctx, "rpc.serverInfo", nil, &info); err != nil {
+		e.cmd.Process.Kill()
+		e.cmd.Wait()
+		return fmt.Errorf("discovering methods: %w", err)
+	}
+	e.methods = info.Methods
+	go e.monitor()
+	return nil
+}
+
+// Update implements Updater. The methods of the plugin are discovered only
+// when it starts, so a change to its command is reported as an error; the new
+// command takes effect when the server restarts.
+func (e *externalPlugin) Update(cfg *Config) error {
+	if !cfg.PluginEnabled(e.name) || cfg.Plugins[e.name] == nil {
+		log.Printf("WARNING: External plugin %q was removed; it will stop at restart", e.name)
+		return nil
+	}
+	args, err := pluginCommand(cfg, e.name)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !slices.Equal(args, e.command) {
+		return fmt.Errorf("the command of external plugin %q cannot be changed without a restart", e.name)
+	}
+	return nil
+}
+
+// Assigner implements part of Plugin.
+func (e *externalPlugin) Assigner() handler.Map {
+	m := make(handler.Map)
+	for _, method := range e.methods {
+		m[method] = e.forward(method)
+	}
+	return m
+}
+
+// Shutdown implements Shutdowner. It closes the input of the subprocess and
+// waits for it to exit, killing it if ctx ends first. Once Shutdown has begun,
+// the monitor does not restart the subprocess.
+func (e *externalPlugin) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	close(e.stop)
+	e.cli.Close()
+	cmd := e.cmd
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-e.done
+		return ctx.Err()
+	}
+}
+
+// forward returns a handler that forwards calls of method to the subprocess.
+func (e *externalPlugin) forward(method string) jrpc2.Handler {
+	return func(ctx context.Context, req *jrpc2.Request) (any, error) {
+		e.mu.Lock()
+		cli := e.cli
+		e.mu.Unlock()
+
+		var params any
+		if req.HasParams() {
+			params = json.RawMessage(req.ParamString())
+		}
+		if req.IsNotification() {
+			return nil, cli.Notify(ctx, method, params)
+		}
+		rsp, err := cli.Call(ctx, method, params)
+		if err != nil && cli.IsStopped() && ctx.Err() == nil {
+			return nil, jrpc2.Errorf(jrpc2.SystemError, "plugin %q is not running", e.name)
+		} else if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(rsp.ResultString()), nil
+	}
+}
+
+// startLocked starts the subprocess and connects a client to it.
+// The caller must hold e.mu.
+func (e *externalPlugin) startLocked() error {
+	cmd := exec.Command(e.command[0], e.command[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting plugin %q: %w", e.name, err)
+	}
+	e.cmd = cmd
+	e.cli = jrpc2.NewClient(channel.Line(out, in), nil)
+	return nil
+}
+
+// monitor waits for the subprocess to exit and restarts it, until the plugin
+// is shut down.
+func (e *externalPlugin) monitor() {
+	defer close(e.done)
+	delay := minRestartDelay
+	for {
+		e.mu.Lock()
+		cmd, cli := e.cmd, e.cli
+		e.mu.Unlock()
+
+		start := time.Now()
+		err := cmd.Wait()
+		cli.Close()
+		select {
+		case <-e.stop:
+			return
+		default:
+		}
+		if time.Since(start) >= maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		for {
+			log.Printf("External plugin %q exited (%v); restarting in %v", e.name, err, delay)
+			select {
+			case <-e.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxRestartDelay)
+
+			// Check for shutdown while holding the lock, so that Shutdown
+			// always sees the last process started.
+			e.mu.Lock()
+			select {
+			case <-e.stop:
+				e.mu.Unlock()
+				return
+			default:
+			}
+			err = e.startLocked()
+			e.mu.Unlock()
+			if err == nil {
+				break
+			}
+		}
+	}
+}
@@ -5,11 +5,12 @@ go 1.25.0
 require (
 	bitbucket.org/creachadair/shell v0.0.9
 	bitbucket.org/creachadair/stringset v0.0.14
+	github.com/coder/websocket v1.8.14
 	github.com/creachadair/atomicfile v0.4.1
 	github.com/creachadair/jrpc2 v1.3.5
 	github.com/kr/text v0.2.0 // indirect
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
-	golang.org/x/sys v0.43.0 // indirect
+	golang.org/x/sys v0.43.0
 	golang.org/x/term v0.42.0
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,141 @@
+package notifier
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/creachadair/jrpc2/jhttp"
+)
+
+// Paths served by an HTTP listener.
+const (
+	httpRPCPath       = "/rpc" // JSON-RPC requests in POST bodies
+	httpWebSocketPath = "/ws"  // JSON-RPC over a WebSocket
+)
+
+// Timeouts for the HTTP server. A response, including the result of a call
+// that waits for the user, must be written within httpWriteTimeout of reading
+// the request. A WebSocket session is not subject to these timeouts once it is
+// established.
+const (
+	httpWriteTimeout = 10 * time.Minute
+	httpIdleTimeout  = 2 * time.Minute
+)
+
+// connKey is the context key for the connection of an HTTP request.
+type connKey struct{}
+
+// serveHTTP serves HTTP requests from the listener of ep until it is closed.
+// Each POST to /rpc is served as a separate session, while a WebSocket
+// connection to /ws is served as a single session for its lifetime.  The REST
+// endpoints described by restRoutes are also served.
+func (s *Server) serveHTTP(ctx context.Context, ep *endpoint) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(httpRPCPath, func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := s.httpSession(w, r, ep); ok {
+			s.serveRPC(w, r, sess)
+		}
+	})
+	mux.HandleFunc("GET "+httpWebSocketPath, func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := s.httpSession(w, r, ep); ok {
+			s.serveWebSocket(ctx, w, r, sess)
+		}
+	})
+	s.restRoutes(mux, ep)
+	hs := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, conn)
+		},
+	}
+	s.mu.Lock()
+	ep.hs = hs
+	s.mu.Unlock()
+	return hs.Serve(ep.ln)
+}
+
+// httpSession identifies the client of r and returns a session for it. If the
+// client is not permitted to connect, httpSession writes an error response to
+// w and returns false.
+//
+// A client may authenticate by sending one of the tokens of ep in an
+// "Authorization: Bearer" header. Requests from a browser are permitted only
+// from the origins allowed by ep, and requests over TCP must address the
+// server by a loopback address or a host name allowed by ep.
+func (s *Server) httpSession(w http.ResponseWriter, r *http.Request, ep *endpoint) (*session, bool) {
+	conn, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusInternalServerError)
+		return nil, false
+	}
+	peer, err := s.identify(conn, ep)
+	if err != nil {
+		log.Printf("Rejected request from %s: %v", peer, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	pol := s.policy(ep)
+	if peer.Network != "unix" && !hostAllowed(pol.hosts, r.Host) {
+		log.Printf("Rejected request from %s: host %q not allowed", peer, r.Host)
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return nil, false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !slices.Contains(pol.origins, origin) {
+		log.Printf("Rejected request from %s: origin %q not allowed", peer, origin)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, false
+	}
+	sess := &session{peer: peer, ep: ep}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		name, valid := checkToken(pol.tokens, token)
+		if !ok || !valid {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return nil, false
+		}
+		sess.peer.Token, sess.token = name, token
+	}
+	return sess, true
+}
+
+// hostAllowed reports whether host, the value of a Host header, names a
+// loopback address, "localhost", or one of the allowed host names.
+func hostAllowed(allowed []string, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); (ip != nil && ip.IsLoopback()) || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	return slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, host) })
+}
+
+// serveRPC serves the JSON-RPC request in the body of r.
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request, sess *session) {
+	b := jhttp.NewBridge(dispatcher{s: s, sess: sess}, &jhttp.BridgeOptions{
+		Server: s.serverOptions(r.Context(), sess),
+	})
+	defer b.Close()
+	b.ServeHTTP(w, r)
+}
+
+// serveWebSocket upgrades r to a WebSocket and serves a session on it.
+func (s *Server) serveWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, sess *session) {
+	ch, err := acceptWebSocket(w, r)
+	if err != nil {
+		s.log.Printf("WebSocket handshake with %s failed: %v", sess.Peer(), err)
+		return
+	}
+	s.serveConn(ctx, ch, sess)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package notifier
+
+import "os"
+
+// tryLock is not supported on this platform, and always succeeds.
+func tryLock(*os.File) error { return nil }
@@ -0,0 +1,14 @@
+//go:build unix
+
+package notifier
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock acquires an exclusive lock on f without blocking.
+func tryLock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+}
@@ -0,0 +1,246 @@
+// Program noteproxy relays the calls of local clients to a noteserver on
+// another machine, over a single connection made by the server.
+//
+// The noteproxy listens for clients on a local socket, by default the one
+// named by NOTIFIER_ADDR, and for the server on the -upstream address. The
+// server connects to the upstream address using a "dial" entry in its
+// configuration, for example:
+//
+//	dial:
+//	  - address: build.example.com:9010
+//	    tls: {caFile: proxy-ca.pem}
+//	    token: SECRET
+//	    acl: {"*": ["Notify.*", "Clip.*"]}
+//
+// and on the remote host, where the file proxy.token contains SECRET:
+//
+//	noteproxy -upstream :9010 -tls-cert proxy.crt -tls-key proxy.key \
+//	   -upstream-token-file proxy.token
+//
+// Clients of the proxy act with the authority of the server connection, and
+// a new server connection replaces the previous one, so the proxy must verify
+// the server: An -upstream TCP address, even on the loopback interface,
+// requires either -tls-client-ca, to verify the server's certificate, or
+// -upstream-token-file, to check the token the server sends when it connects.
+// A token requires TLS on an address that is not on the loopback interface.
+//
+// A client socket is accessible only to the current user. A client listener
+// on a TCP address requires -client-token-file, and each client must call
+// Session.Auth with the token in that file before its calls are relayed.
+//
+// The calls of all clients share the one upstream connection; the proxy
+// assigns each call a new request ID on the way up, and restores the client's
+// ID in the response. While no server is connected, calls fail immediately.
+//
+// With "-upstream -", the proxy uses stdin and stdout as the upstream
+// connection and exits when its input is closed. For example, to connect a
+// proxy over SSH to a server started with -stdio:
+//
+//	socat EXEC:"noteserver -config notifier.yml -stdio" EXEC:"ssh host noteproxy -upstream -"
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/notifier"
+)
+
+var (
+	clientAddr   = flag.String("address", os.Getenv("NOTIFIER_ADDR"), "Listen for clients at this address")
+	upstreamAddr = flag.String("upstream", "", `Listen for the server at this address ("-" for stdin/stdout)`)
+	tlsCert      = flag.String("tls-cert", "", "TLS: certificate file for the upstream listener")
+	tlsKey       = flag.String("tls-key", "", "TLS: key file for the upstream listener")
+	tlsClientCA  = flag.String("tls-client-ca", "", "TLS: require server certificates from these CAs")
+	upTokenFile  = flag.String("upstream-token-file", "", "Require the server to send the token in this file")
+	cliTokenFile = flag.String("client-token-file", "", "Require clients to authenticate with the token in this file")
+)
+
+func main() {
+	flag.Parse()
+	if *clientAddr == "" {
+		log.Fatal("You must provide a non-empty -address or set NOTIFIER_ADDR")
+	} else if *upstreamAddr == "" {
+		log.Fatal("You must provide a non-empty -upstream address")
+	}
+	cfg := &notifier.Config{TLS: notifier.TLSConfig{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsKey,
+		ClientCAFile: *tlsClientCA,
+	}}
+	tc, err := cfg.ServerTLS()
+	if err != nil {
+		log.Fatalf("TLS settings: %v", err)
+	} else if tc != nil && *upstreamAddr == "-" {
+		log.Fatal("TLS settings do not apply to -upstream -")
+	}
+	upToken := readToken(*upTokenFile)
+	if *upstreamAddr == "-" {
+		if upToken != "" {
+			log.Fatal("An upstream token does not apply to -upstream -")
+		}
+	} else if atype, _ := jrpc2.Network(*upstreamAddr); atype != "unix" {
+		if *tlsClientCA == "" && upToken == "" {
+			log.Fatal("A TCP -upstream address requires -tls-client-ca or -upstream-token-file")
+		} else if upToken != "" && tc == nil && !isLocal(*upstreamAddr) {
+			log.Fatal("An upstream token on an address that is not local requires TLS")
+		}
+	}
+	r := relay{token: readToken(*cliTokenFile)}
+	if atype, _ := jrpc2.Network(*clientAddr); atype != "unix" && r.token == "" {
+		log.Fatal("A TCP client -address requires -client-token-file")
+	}
+
+	cln := listen(*clientAddr)
+	defer cln.Close()
+	var uln net.Listener
+	if *upstreamAddr != "-" {
+		uln = listen(*upstreamAddr)
+		defer uln.Close()
+		if tc != nil {
+			uln = tls.NewListener(uln, tc)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 2)
+	go func() { errc <- acceptClients(cln, &r) }()
+	if uln == nil {
+		go func() { errc <- r.serveUpstream(channel.Line(os.Stdin, os.Stdout)) }()
+	} else {
+		go func() { errc <- acceptUpstream(uln, &r, upToken) }()
+	}
+	log.Printf("Relaying clients at %q to upstream %q", *clientAddr, *upstreamAddr)
+
+	select {
+	case <-ctx.Done():
+		log.Printf("Received signal; shutting down")
+	case err := <-errc:
+		if err != nil && !isClosed(err) {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+}
+
+// listen listens at addr, and limits access to a Unix-domain socket to the
+// current user, since clients of the proxy act with the authority of the
+// upstream connection.
+func listen(addr string) net.Listener {
+	ln, err := notifier.ListenPrivate(addr)
+	if err != nil {
+		log.Fatalf("Listen: %v", err)
+	}
+	return ln
+}
+
+// readToken returns the token in the file at path, or "" if path is empty.
+func readToken(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Reading token: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		log.Fatalf("Token file %q is empty", path)
+	}
+	return token
+}
+
+// isLocal reports whether addr is a Unix-domain socket or a loopback address.
+func isLocal(addr string) bool {
+	atype, addr := jrpc2.Network(addr)
+	if atype == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	} else if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// acceptClients accepts connections from local clients on ln and relays them
+// through r, until ln fails.
+func acceptClients(ln net.Listener, r *relay) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go r.serveClient(channel.Line(conn, conn))
+	}
+}
+
+// acceptUpstream accepts connections from the server on ln and makes each the
+// active upstream of r, until ln fails. If token != "", a connection is used
+// only if the server sends token when it connects.
+func acceptUpstream(ln net.Listener, r *relay, token string) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			addr := conn.RemoteAddr()
+			ch := channel.Line(conn, conn)
+			if token != "" {
+				conn.SetReadDeadline(time.Now().Add(authTimeout))
+				if err := checkToken(ch, token); err != nil {
+					log.Printf("Rejected upstream from %s: %v", addr, err)
+					conn.Close()
+					return
+				}
+				conn.SetReadDeadline(time.Time{})
+			}
+			log.Printf("Upstream connected from %s", addr)
+			if err := r.serveUpstream(ch); isClosed(err) {
+				log.Printf("Upstream %s disconnected", addr)
+			} else {
+				log.Printf("Upstream %s disconnected: %v", addr, err)
+			}
+		}()
+	}
+}
+
+// authTimeout is how long the server has to send its token after connecting.
+const authTimeout = 30 * time.Second
+
+// checkToken reads the first message from the server on ch, and reports an
+// error unless it is a Session.Auth notification with token.
+func checkToken(ch channel.Channel, token string) error {
+	data, err := ch.Recv()
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Method string               `json:"method"`
+		ID     json.RawMessage      `json:"id"`
+		Params notifier.AuthRequest `json:"params"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.Method != "Session.Auth" || req.ID != nil {
+		return errors.New("server did not authenticate")
+	} else if subtle.ConstantTimeCompare([]byte(req.Params.Token), []byte(token)) != 1 {
+		return errors.New("invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/notifier"
+)
+
+// A relay forwards the calls of local clients over a shared upstream
+// connection to a noteserver. Each call is assigned a new request ID for the
+// upstream connection, and the ID assigned by the client is restored in the
+// response.
+//
+// The elements of a batch are forwarded separately, so the responses to a
+// batch may be delivered in more than one message.
+type relay struct {
+	token string // if set, clients must authenticate with this token
+
+	mu     sync.Mutex
+	up     *upstream // the active upstream connection, or nil
+	nextID int64
+}
+
+// An upstream is a connection to a noteserver.
+type upstream struct {
+	*link
+	pending map[string]*call // by upstream request ID; guarded by relay.mu
+}
+
+// A call records the origin of a call forwarded upstream.
+type call struct {
+	cli *link
+	id  json.RawMessage // the request ID assigned by the client
+}
+
+// A link is a channel that permits concurrent senders.
+type link struct {
+	ch channel.Channel
+	mu sync.Mutex
+
+	authed bool // for a client, whether it has authenticated; used by forward
+}
+
+func (l *link) send(msg []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ch.Send(msg)
+}
+
+// reply sends a response to the request with the given ID on l, reporting
+// result if err == nil, or otherwise err.
+func (l *link) reply(id json.RawMessage, result any, err *jrpc2.Error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	msg, _ := json.Marshal(response{V: "2.0", ID: id, Result: result, Error: err})
+	l.send(msg)
+}
+
+type response struct {
+	V      string          `json:"jsonrpc"`
+	ID     json.RawMessage `json:"id"`
+	Result any             `json:"result,omitempty"`
+	Error  *jrpc2.Error    `json:"error,omitempty"`
+}
+
+// serveClient forwards the requests of a local client on ch until the client
+// disconnects.
+func (r *relay) serveClient(ch channel.Channel) {
+	defer ch.Close()
+	cli := &link{ch: ch}
+	for {
+		data, err := ch.Recv()
+		if err != nil {
+			if !isClosed(err) {
+				log.Printf("Client receive failed: %v", err)
+			}
+			return
+		}
+		msgs, err := splitBatch(data)
+		if err != nil {
+			cli.reply(nil, nil, jrpc2.Errorf(jrpc2.ParseError, "invalid JSON"))
+			continue
+		}
+		for _, msg := range msgs {
+			r.forward(cli, msg)
+		}
+	}
+}
+
+// forward sends the request in msg from cli to the active upstream.
+//
+// Calls to Session.Auth are answered by the relay, which checks the token
+// against r.token: The upstream session is shared by all clients, so a token
+// sent upstream would authenticate every client. If r.token is empty, access
+// to the relay is controlled by the permissions of its socket.
+func (r *relay) forward(cli *link, msg json.RawMessage) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &req); err != nil {
+		cli.reply(nil, nil, jrpc2.Errorf(jrpc2.InvalidRequest, "request must be an object"))
+		return
+	} else if _, ok := req["method"]; !ok {
+		return // a response to the server; the relay does not forward pushes
+	}
+	id := req["id"]
+	isCall := id != nil && string(id) != "null"
+	var method string
+	json.Unmarshal(req["method"], &method)
+	if method == "Session.Auth" {
+		var ar notifier.AuthRequest
+		json.Unmarshal(req["params"], &ar)
+		ok := r.token == "" || subtle.ConstantTimeCompare([]byte(ar.Token), []byte(r.token)) == 1
+		cli.authed = cli.authed || ok
+		if !isCall {
+			return
+		} else if ok {
+			cli.reply(id, true, nil)
+		} else {
+			cli.reply(id, nil, jrpc2.Errorf(notifier.Unauthorized, "invalid token"))
+		}
+		return
+	} else if r.token != "" && !cli.authed {
+		if isCall {
+			cli.reply(id, nil, jrpc2.Errorf(notifier.Unauthorized, "authentication required"))
+		}
+		return
+	}
+
+	r.mu.Lock()
+	up := r.up
+	var key string
+	if up != nil && isCall {
+		r.nextID++
+		key = strconv.FormatInt(r.nextID, 10)
+		up.pending[key] = &call{cli: cli, id: id}
+		req["id"] = json.RawMessage(key)
+	}
+	r.mu.Unlock()
+
+	if up == nil {
+		if isCall {
+			cli.reply(id, nil, jrpc2.Errorf(jrpc2.SystemError, "no upstream server is connected"))
+		}
+		return
+	}
+	out, _ := json.Marshal(req)
+	if err := up.send(out); err != nil && isCall {
+		if c := r.take(up, key); c != nil {
+			cli.reply(id, nil, jrpc2.Errorf(jrpc2.SystemError, "sending upstream: %v", err))
+		}
+	}
+}
+
+// serveUpstream makes ch the active upstream connection, replacing any
+// previous one, and delivers responses from ch to the clients that sent the
+// corresponding calls until ch fails. Calls still pending when ch fails are
+// answered with an error.
+func (r *relay) serveUpstream(ch channel.Channel) error {
+	up := &upstream{link: &link{ch: ch}, pending: make(map[string]*call)}
+	r.mu.Lock()
+	old := r.up
+	r.up = up
+	r.mu.Unlock()
+	if old != nil {
+		log.Printf("Replacing previous upstream connection")
+		old.ch.Close()
+	}
+	defer r.detach(up)
+
+	for {
+		data, err := ch.Recv()
+		if err != nil {
+			return err
+		}
+		msgs, err := splitBatch(data)
+		if err != nil {
+			log.Printf("Invalid message from upstream: %v", err)
+			continue
+		}
+		for _, msg := range msgs {
+			r.deliver(up, msg)
+		}
+	}
+}
+
+// deliver sends the response in msg from up to the client that sent the
+// corresponding call.
+func (r *relay) deliver(up *upstream, msg json.RawMessage) {
+	var rsp map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &rsp); err != nil {
+		log.Printf("Invalid response from upstream: %v", err)
+		return
+	} else if _, ok := rsp["method"]; ok {
+		// The upstream session is shared, so there is no client to deliver a
+		// push to.
+		if id, ok := rsp["id"]; ok {
+			up.reply(id, nil, jrpc2.Errorf(jrpc2.MethodNotFound, "callbacks are not relayed"))
+		}
+		return
+	}
+	c := r.take(up, string(rsp["id"]))
+	if c == nil {
+		log.Printf("Discarding upstream response with unknown ID %s", rsp["id"])
+		return
+	}
+	rsp["id"] = c.id
+	out, _ := json.Marshal(rsp)
+	c.cli.send(out) // the client may have gone away
+}
+
+// take removes and returns the pending call of up with the given upstream
+// ID, or nil if there is none.
+func (r *relay) take(up *upstream, key string) *call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := up.pending[key]
+	delete(up.pending, key)
+	return c
+}
+
+// detach closes up, and answers its pending calls with an error.
+func (r *relay) detach(up *upstream) {
+	r.mu.Lock()
+	if r.up == up {
+		r.up = nil
+	}
+	pending := up.pending
+	up.pending = nil
+	r.mu.Unlock()
+
+	up.ch.Close()
+	for _, c := range pending {
+		c.cli.reply(c.id, nil, jrpc2.Errorf(jrpc2.SystemError, "upstream connection lost"))
+	}
+}
+
+// splitBatch returns the messages in data, which is either a single message
+// or a batch.
+func splitBatch(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) != 0 && data[0] == '[' {
+		var msgs []json.RawMessage
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, err
+		}
+		return msgs, nil
+	} else if !json.Valid(data) {
+		return nil, errors.New("invalid JSON")
+	}
+	return []json.RawMessage{data}, nil
+}
+
+// isClosed reports whether err indicates the peer closed the connection.
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
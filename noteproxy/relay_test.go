@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/notifier"
+)
+
+// pipe returns the ends of a synchronous in-memory connection.
+func pipe(t *testing.T) (channel.Channel, channel.Channel) {
+	a, b := net.Pipe()
+	t.Cleanup(func() { a.Close(); b.Close() })
+	return channel.Line(a, a), channel.Line(b, b)
+}
+
+// attach connects a new upstream to r, and returns the server's end of it.
+func attach(t *testing.T, r *relay) channel.Channel {
+	t.Helper()
+	srv, up := pipe(t)
+	go r.serveUpstream(up)
+	for {
+		r.mu.Lock()
+		ok := r.up != nil
+		r.mu.Unlock()
+		if ok {
+			return srv
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// connect connects a new client to r, and returns the client's end of it.
+func connect(t *testing.T, r *relay) channel.Channel {
+	t.Helper()
+	cli, ch := pipe(t)
+	go r.serveClient(ch)
+	return cli
+}
+
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *jrpc2.Error    `json:"error"`
+}
+
+func send(t *testing.T, ch channel.Channel, msg string) {
+	t.Helper()
+	if err := ch.Send([]byte(msg)); err != nil {
+		t.Fatalf("Send %#q: %v", msg, err)
+	}
+}
+
+func recv(t *testing.T, ch channel.Channel) message {
+	t.Helper()
+	data, err := ch.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Invalid message %#q: %v", data, err)
+	}
+	return msg
+}
+
+func checkReply(t *testing.T, msg message, id string, code jrpc2.Code) {
+	t.Helper()
+	if string(msg.ID) != id {
+		t.Errorf("Reply ID: got %s, want %s", msg.ID, id)
+	}
+	got := jrpc2.NoError
+	if msg.Error != nil {
+		got = msg.Error.Code
+	}
+	if got != code {
+		t.Errorf("Reply %s: got error %v, want code %v", msg.ID, msg.Error, code)
+	}
+}
+
+func TestRelayIDs(t *testing.T) {
+	r := new(relay)
+	up := attach(t, r)
+	c1, c2 := connect(t, r), connect(t, r)
+
+	// Both clients use the same ID, but the calls are distinct upstream.
+	send(t, c1, `{"jsonrpc":"2.0","id":"a","method":"Clip.List"}`)
+	m1 := recv(t, up)
+	send(t, c2, `{"jsonrpc":"2.0","id":"a","method":"Clip.List"}`)
+	m2 := recv(t, up)
+	if string(m1.ID) == string(m2.ID) {
+		t.Fatalf("Upstream IDs are both %s", m1.ID)
+	}
+
+	// Answer in the opposite order; each client gets its own response.
+	send(t, up, `{"jsonrpc":"2.0","id":`+string(m2.ID)+`,"result":2}`)
+	if got := recv(t, c2); string(got.ID) != `"a"` || string(got.Result) != "2" {
+		t.Errorf("Client 2: got %+v, want ID %q and result 2", got, "a")
+	}
+	send(t, up, `{"jsonrpc":"2.0","id":`+string(m1.ID)+`,"result":1}`)
+	if got := recv(t, c1); string(got.ID) != `"a"` || string(got.Result) != "1" {
+		t.Errorf("Client 1: got %+v, want ID %q and result 1", got, "a")
+	}
+}
+
+func TestRelayBatch(t *testing.T) {
+	r := new(relay)
+	up := attach(t, r)
+	cli := connect(t, r)
+
+	send(t, cli, `[{"jsonrpc":"2.0","id":1,"method":"A"},{"jsonrpc":"2.0","method":"B"},`+
+		`{"jsonrpc":"2.0","id":2,"method":"C"}]`)
+
+	// The elements of the batch are sent upstream separately, and the
+	// notification keeps its lack of an ID.
+	var ids []json.RawMessage
+	for _, want := range []string{"A", "B", "C"} {
+		msg := recv(t, up)
+		if msg.Method != want {
+			t.Errorf("Upstream: got method %q, want %q", msg.Method, want)
+		}
+		if want == "B" {
+			if msg.ID != nil {
+				t.Errorf("Notification %q has ID %s", want, msg.ID)
+			}
+			continue
+		}
+		ids = append(ids, msg.ID)
+	}
+	for i, id := range ids {
+		send(t, up, `{"jsonrpc":"2.0","id":`+string(id)+`,"result":true}`)
+		checkReply(t, recv(t, cli), []string{"1", "2"}[i], jrpc2.NoError)
+	}
+}
+
+func TestRelayDetach(t *testing.T) {
+	r := new(relay)
+	up := attach(t, r)
+	cli := connect(t, r)
+
+	send(t, cli, `{"jsonrpc":"2.0","id":7,"method":"User.Text"}`)
+	recv(t, up)
+
+	// Calls pending when the upstream goes away are answered with an error,
+	// and later calls fail until a new upstream connects.
+	up.Close()
+	checkReply(t, recv(t, cli), "7", jrpc2.SystemError)
+	send(t, cli, `{"jsonrpc":"2.0","id":8,"method":"Clip.List"}`)
+	checkReply(t, recv(t, cli), "8", jrpc2.SystemError)
+}
+
+func TestRelayAuth(t *testing.T) {
+	r := &relay{token: "secret"}
+	up := attach(t, r)
+	cli := connect(t, r)
+
+	send(t, cli, `{"jsonrpc":"2.0","id":1,"method":"Clip.List"}`)
+	checkReply(t, recv(t, cli), "1", notifier.Unauthorized)
+	send(t, cli, `{"jsonrpc":"2.0","id":2,"method":"Session.Auth","params":{"token":"bogus"}}`)
+	checkReply(t, recv(t, cli), "2", notifier.Unauthorized)
+	send(t, cli, `{"jsonrpc":"2.0","id":3,"method":"Session.Auth","params":{"token":"secret"}}`)
+	checkReply(t, recv(t, cli), "3", jrpc2.NoError)
+
+	// The Session.Auth calls are answered by the relay, so the first message
+	// upstream is the next call.
+	send(t, cli, `{"jsonrpc":"2.0","id":4,"method":"Clip.List"}`)
+	if msg := recv(t, up); msg.Method != "Clip.List" {
+		t.Errorf("Upstream: got method %q, want Clip.List", msg.Method)
+	}
+
+	// Authentication applies only to the client that sent the token.
+	other := connect(t, r)
+	send(t, other, `{"jsonrpc":"2.0","id":5,"method":"Clip.List"}`)
+	checkReply(t, recv(t, other), "5", notifier.Unauthorized)
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"maps"
 	"os"
-	"os/exec"
 	"sync"
 
 	"bitbucket.org/creachadair/stringset"
@@ -18,7 +17,10 @@ import (
 	"github.com/creachadair/notifier"
 )
 
-func init() { notifier.RegisterPlugin("Clip", new(clipper)) }
+func init() { notifier.RegisterPlugin("Clip", New()) }
+
+// New constructs a new, uninitialized instance of the Clip plugin.
+func New() notifier.Plugin { return new(clipper) }
 
 // systemClip is a special-case clipset tag that identifies the currently
 // active system clipboard contents. It appears in clip listings, but is not
@@ -26,25 +28,81 @@ func init() { notifier.RegisterPlugin("Clip", new(clipper)) }
 const systemClip = "active"
 
 type clipper struct {
-	store string
-
 	sync.Mutex
-	saved map[string][]byte
-	svc   handler.Map
+	store   string
+	clip    notifier.Clipboard
+	backend [2]string // the backend settings used to create clip
+	saved   map[string][]byte
+	svc     handler.Map
 }
 
 // Init implements part of notifier.Plugin.
 func (c *clipper) Init(cfg *notifier.Config) error {
+	clip, err := cfg.Clipboard()
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.clip = clip
+	c.backend = backendOf(cfg)
 	c.store = os.ExpandEnv(cfg.Clip.SaveFile)
 	c.saved = make(map[string][]byte)
-	if err := c.loadFromFile(); err != nil {
+	if err := loadFromFile(c.store, c.saved); err != nil {
 		return fmt.Errorf("loading saved clips: %v", err)
 	}
 	return nil
 }
 
-// Update implements part of notifier.Plugin.
-func (*clipper) Update() error { return nil }
+// Update implements part of notifier.Plugin. If the backend settings have
+// changed, it switches to the new backend; otherwise it retains the existing
+// one, so that the contents of a memory clipboard are preserved. If the save
+// file has changed, the clips saved there are merged with the current clips
+// and the result is written to the new file. If the update fails, the state of
+// c is not changed.
+func (c *clipper) Update(cfg *notifier.Config) error {
+	c.Lock()
+	defer c.Unlock()
+	clip := c.clip
+	if cfg.Clip.Clipboard != nil || backendOf(cfg) != c.backend {
+		var err error
+		clip, err = cfg.Clipboard()
+		if err != nil {
+			return err
+		}
+	}
+	store := os.ExpandEnv(cfg.Clip.SaveFile)
+	if store != c.store {
+		saved := maps.Clone(c.saved)
+		if err := loadFromFile(store, saved); err != nil {
+			return fmt.Errorf("loading saved clips: %v", err)
+		}
+		if err := saveToFile(store, saved); err != nil {
+			return fmt.Errorf("saving clips: %v", err)
+		}
+		c.store, c.saved = store, saved
+	}
+	c.clip = clip
+	c.backend = backendOf(cfg)
+	return nil
+}
+
+func backendOf(cfg *notifier.Config) [2]string { return [2]string{cfg.Clip.Backend, cfg.Clip.File} }
+
+// clipboard returns the current clipboard backend.
+func (c *clipper) clipboard() notifier.Clipboard {
+	c.Lock()
+	defer c.Unlock()
+	return c.clip
+}
+
+// Shutdown implements notifier.Shutdowner. It flushes the saved clips to the
+// save file, if one is set.
+func (c *clipper) Shutdown(context.Context) error {
+	c.Lock()
+	defer c.Unlock()
+	return saveToFile(c.store, c.saved)
+}
 
 // Assigner implements part of notifier.Plugin.
 func (c *clipper) Assigner() handler.Map {
@@ -59,26 +117,25 @@ func (c *clipper) Assigner() handler.Map {
 	return c.svc
 }
 
-// saveToFile writes the contents of c.saved to the output file, if one is set.
-// The caller must hold the lock on c.
-func (c *clipper) saveToFile() error {
-	if c.store == "" {
+// saveToFile writes the clips in saved to the store file, if one is set.
+func saveToFile(store string, saved map[string][]byte) error {
+	if store == "" {
 		return nil
 	}
-	out, err := json.Marshal(c.saved)
+	out, err := json.Marshal(saved)
 	if err != nil {
 		return err
 	}
-	return atomicfile.WriteData(c.store, out, 0600)
+	return atomicfile.WriteData(store, out, 0600)
 }
 
-// loadFromFile loads the contents of c.saved and merges it with the current data.
-// The caller must hold the lock on c.
-func (c *clipper) loadFromFile() error {
-	if c.store == "" {
+// loadFromFile loads the clips saved in the store file and merges them into
+// saved. If store is empty or does not exist, saved is unmodified.
+func loadFromFile(store string, saved map[string][]byte) error {
+	if store == "" {
 		return nil
 	}
-	bits, err := os.ReadFile(c.store)
+	bits, err := os.ReadFile(store)
 	if os.IsNotExist(err) {
 		return nil
 	} else if err != nil {
@@ -88,7 +145,7 @@ func (c *clipper) loadFromFile() error {
 	if err := json.Unmarshal(bits, &m); err != nil {
 		return err
 	}
-	maps.Copy(c.saved, m)
+	maps.Copy(saved, m)
 	return nil
 }
 
@@ -100,16 +157,17 @@ func (c *clipper) Set(ctx context.Context, req *notifier.ClipSetRequest) (bool,
 	}
 
 	// If we were requested to save the existing clip, extract its data.
+	clip := c.clipboard()
 	var saved []byte
 	if req.Save != "" {
-		data, err := getClip(ctx)
+		data, err := clip.GetClipboard(ctx)
 		if err != nil {
 			return false, err
 		}
 		saved = data
 	}
 
-	if err := notifier.SetSystemClipboard(ctx, req.Data); err != nil {
+	if err := clip.SetClipboard(ctx, req.Data); err != nil {
 		return false, err
 	}
 
@@ -123,14 +181,14 @@ func (c *clipper) Set(ctx context.Context, req *notifier.ClipSetRequest) (bool,
 	if req.Save != "" {
 		c.saved[req.Save] = saved
 	}
-	c.saveToFile()
+	saveToFile(c.store, c.saved)
 	c.Unlock()
 	return true, nil
 }
 
 func (c *clipper) Get(ctx context.Context, req *notifier.ClipGetRequest) ([]byte, error) {
 	if req.Tag == "" || req.Tag == systemClip {
-		return getClip(ctx)
+		return c.clipboard().GetClipboard(ctx)
 	} else if req.Activate && req.Tag == req.Save {
 		return nil, jrpc2.Errorf(jrpc2.InvalidParams, "tag and save are equal")
 	}
@@ -141,13 +199,13 @@ func (c *clipper) Get(ctx context.Context, req *notifier.ClipGetRequest) ([]byte
 		return nil, jrpc2.Errorf(notifier.ResourceNotFound, "tag %q not found", req.Tag)
 	} else if req.Activate {
 		if req.Save != "" {
-			active, err := getClip(ctx)
+			active, err := c.clip.GetClipboard(ctx)
 			if err != nil {
 				return nil, err
 			}
 			c.saved[req.Save] = active
 		}
-		if err := notifier.SetSystemClipboard(ctx, data); err != nil {
+		if err := c.clip.SetClipboard(ctx, data); err != nil {
 			return nil, err
 		}
 	}
@@ -164,16 +222,12 @@ func (c *clipper) List(ctx context.Context) ([]string, error) {
 
 func (c *clipper) Clear(ctx context.Context, req *notifier.ClipClearRequest) (bool, error) {
 	if req.Tag == "" || req.Tag == systemClip {
-		err := notifier.SetSystemClipboard(ctx, nil)
+		err := c.clipboard().SetClipboard(ctx, nil)
 		return err == nil, err
 	}
 	c.Lock()
 	defer c.Unlock()
 	_, ok := c.saved[req.Tag]
 	delete(c.saved, req.Tag)
-	return ok, c.saveToFile()
-}
-
-func getClip(ctx context.Context) ([]byte, error) {
-	return exec.CommandContext(ctx, "pbpaste", "-pboard", "general").Output()
+	return ok, saveToFile(c.store, c.saved)
 }
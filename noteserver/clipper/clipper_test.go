@@ -0,0 +1,41 @@
+package clipper_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/notifier"
+	"github.com/creachadair/notifier/notifiertest"
+)
+
+func TestUpdateSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	saveFile := filepath.Join(dir, "clips.json")
+	cfg := new(notifier.Config)
+	cfg.Clip.SaveFile = saveFile
+	s := notifiertest.NewServer(cfg)
+	defer s.Close()
+
+	// Moving the clips to a file that cannot be written fails, and the clips
+	// are still saved to the original file.
+	next := *s.Config
+	next.Clip.SaveFile = filepath.Join(dir, "nonesuch", "clips.json")
+	if err := s.Registry.Update(&next); err == nil {
+		t.Fatal("Update: got nil error, want an error")
+	}
+
+	ctx := context.Background()
+	if _, err := s.Client.Call(ctx, "Clip.Set", &notifier.ClipSetRequest{Tag: "x", Data: []byte("hello")}); err != nil {
+		t.Fatalf("Clip.Set: %v", err)
+	}
+	data, err := os.ReadFile(saveFile)
+	if err != nil {
+		t.Fatalf("Reading save file: %v", err)
+	}
+	if !strings.Contains(string(data), `"x"`) {
+		t.Errorf("Save file: got %#q, want it to contain clip x", data)
+	}
+}
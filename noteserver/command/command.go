@@ -0,0 +1,316 @@
+// Package command exports a service whose methods run local commands. The
+// methods are defined in the settings for the "Command" plugin, for example:
+//
+//	plugins:
+//	  Command:
+//	    settings:
+//	      methods:
+//	        Lock:
+//	          command: pmset displaysleepnow
+//	        Open:
+//	          command: open -a "$app" -- $path
+//	          params:
+//	            app: {required: true}
+//	            path: {default: "."}
+//	          timeout: 10s
+//	        Count:
+//	          command: wc -l
+//	          stdin: text
+//	          params:
+//	            text: {required: true}
+//	          output: true
+//
+// The command line is split into words using shell quoting rules, and then
+// parameter references of the form $name or ${name} are expanded within each
+// word. A parameter value is never split into multiple words.
+//
+// The first word, naming the program to run, may not refer to parameters. A
+// value supplied by the caller for a parameter that begins a word may not start
+// with "-", so that it cannot be mistaken for an option, unless the parameter
+// sets allowDash:
+//
+//	params:
+//	  pattern: {required: true, allowDash: true}
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/creachadair/shell"
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/handler"
+	"github.com/creachadair/notifier"
+)
+
+func init() { notifier.RegisterPlugin("Command", New()) }
+
+// New constructs a new, uninitialized instance of the Command plugin.
+func New() notifier.Plugin { return new(runner) }
+
+// settings is the structure of the plugin settings.
+type settings struct {
+	Methods map[string]*method
+}
+
+// A method describes a single command method.
+type method struct {
+	// The command line template. Required.
+	Command string
+
+	// The parameters accepted by the method, by name.
+	Params map[string]*param
+
+	// If set, the name of a parameter whose value is written to the stdin of
+	// the command. Otherwise, the command reads no input.
+	Stdin string
+
+	// If positive, the command is killed if it runs longer than this.
+	Timeout time.Duration
+
+	// If true, the method returns the output of the command as a string.
+	// Otherwise it returns true when the command succeeds.
+	Output bool
+
+	args []string // the parsed command line
+}
+
+// A param describes a parameter of a method.
+type param struct {
+	// The type of the parameter: string (default), int, or bool.
+	Type string
+
+	// Whether the caller must provide a value.
+	Required bool
+
+	// The value used if the caller does not provide one.
+	Default string
+
+	// Whether the caller may provide a value beginning with "-" for a
+	// parameter that begins a word of the command line.
+	AllowDash bool `yaml:"allowDash"`
+
+	leading bool // whether the parameter begins a word of the command line
+}
+
+// check reports whether m is a valid method definition, and parses its
+// command line.
+func (m *method) check() error {
+	args, ok := shell.Split(m.Command)
+	if !ok || len(args) == 0 {
+		return fmt.Errorf("invalid command %q", m.Command)
+	}
+	for name, p := range m.Params {
+		if p == nil {
+			p = new(param)
+			m.Params[name] = p
+		}
+		switch p.Type {
+		case "", "string", "int", "bool":
+		default:
+			return fmt.Errorf("parameter %q: unknown type %q", name, p.Type)
+		}
+	}
+	for i, arg := range args {
+		var err error
+		var first string
+		exp := os.Expand(arg, func(name string) string {
+			if _, ok := m.Params[name]; !ok && err == nil {
+				err = fmt.Errorf("command refers to undefined parameter %q", name)
+			} else if i == 0 && err == nil {
+				err = fmt.Errorf("command name may not refer to parameter %q", name)
+			}
+			if first == "" {
+				first = name
+			}
+			return "\x00"
+		})
+		if err != nil {
+			return err
+		} else if strings.HasPrefix(exp, "\x00") {
+			m.Params[first].leading = true
+		}
+	}
+	if _, ok := m.Params[m.Stdin]; m.Stdin != "" && !ok {
+		return fmt.Errorf("stdin refers to undefined parameter %q", m.Stdin)
+	}
+	m.args = args
+	return nil
+}
+
+type runner struct {
+	mu      sync.Mutex
+	methods map[string]*method
+}
+
+// load decodes and checks the method definitions from cfg.
+func load(cfg *notifier.Config) (map[string]*method, error) {
+	var s settings
+	if err := cfg.PluginSettings("Command", &s); err != nil {
+		return nil, err
+	}
+	for name, m := range s.Methods {
+		if m == nil {
+			return nil, fmt.Errorf("method %q: missing definition", name)
+		} else if err := m.check(); err != nil {
+			return nil, fmt.Errorf("method %q: %w", name, err)
+		}
+	}
+	return s.Methods, nil
+}
+
+// Init implements part of notifier.Plugin. It reports ErrNotApplicable if no
+// methods are defined.
+func (r *runner) Init(cfg *notifier.Config) error {
+	methods, err := load(cfg)
+	if err != nil {
+		return err
+	} else if len(methods) == 0 {
+		return notifier.ErrNotApplicable
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methods = methods
+	return nil
+}
+
+// Update implements part of notifier.Plugin. Changes to existing methods take
+// effect immediately, and removed methods are no longer available. Methods
+// added by the update are not available until the server restarts.
+func (r *runner) Update(cfg *notifier.Config) error {
+	methods, err := load(cfg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methods = methods
+	return nil
+}
+
+// Assigner implements part of notifier.Plugin.
+func (r *runner) Assigner() handler.Map {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := make(handler.Map)
+	for name := range r.methods {
+		m[name] = func(ctx context.Context, req *jrpc2.Request) (any, error) {
+			return r.run(ctx, name, req)
+		}
+	}
+	return m
+}
+
+// run executes the named method with the parameters from req.
+func (r *runner) run(ctx context.Context, name string, req *jrpc2.Request) (any, error) {
+	r.mu.Lock()
+	m, ok := r.methods[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, jrpc2.Errorf(jrpc2.MethodNotFound, "method %q is no longer defined", name)
+	}
+
+	vals, err := m.bind(req)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, len(m.args))
+	for i, arg := range m.args {
+		args[i] = os.Expand(arg, func(key string) string { return vals[key] })
+	}
+
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if m.Stdin != "" {
+		cmd.Stdin = strings.NewReader(vals[m.Stdin])
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && m.Timeout > 0 {
+			return nil, jrpc2.Errorf(jrpc2.DeadlineExceeded, "command timed out after %v", m.Timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if m.Output {
+		return stdout.String(), nil
+	}
+	return true, nil
+}
+
+// bind decodes the parameters of req and checks them against the parameters
+// of m, returning the value of each parameter as a string.
+func (m *method) bind(req *jrpc2.Request) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if req.HasParams() {
+		if err := req.UnmarshalParams(&raw); err != nil {
+			return nil, jrpc2.Errorf(jrpc2.InvalidParams, "parameters must be an object")
+		}
+	}
+	for name := range raw {
+		if _, ok := m.Params[name]; !ok {
+			return nil, jrpc2.Errorf(jrpc2.InvalidParams, "unknown parameter %q", name)
+		}
+	}
+	vals := make(map[string]string)
+	for name, p := range m.Params {
+		data, ok := raw[name]
+		if !ok {
+			if p.Required {
+				return nil, jrpc2.Errorf(jrpc2.InvalidParams, "missing required parameter %q", name)
+			}
+			vals[name] = p.Default
+			continue
+		}
+		v, err := p.decode(data)
+		if err != nil {
+			return nil, jrpc2.Errorf(jrpc2.InvalidParams, "parameter %q: %v", name, err)
+		} else if p.leading && !p.AllowDash && strings.HasPrefix(v, "-") {
+			return nil, jrpc2.Errorf(jrpc2.InvalidParams, "parameter %q: value may not begin with %q", name, "-")
+		}
+		vals[name] = v
+	}
+	return vals, nil
+}
+
+// decode decodes a JSON parameter value of the type expected by p, and
+// returns its string representation.
+func (p *param) decode(data json.RawMessage) (string, error) {
+	switch p.Type {
+	case "int":
+		var z int64
+		if err := json.Unmarshal(data, &z); err != nil {
+			return "", errors.New("value must be an integer")
+		}
+		return strconv.FormatInt(z, 10), nil
+	case "bool":
+		var b bool
+		if err := json.Unmarshal(data, &b); err != nil {
+			return "", errors.New("value must be a Boolean")
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return "", errors.New("value must be a string")
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+)
+
+// request returns a request for a call with the given JSON parameters.
+func request(t *testing.T, params string) *jrpc2.Request {
+	t.Helper()
+	msg := `{"jsonrpc":"2.0","id":1,"method":"Test.Method"`
+	if params != "" {
+		msg += `,"params":` + params
+	}
+	reqs, err := jrpc2.ParseRequests([]byte(msg + "}"))
+	if err != nil || len(reqs) != 1 {
+		t.Fatalf("ParseRequests %#q: %v", msg, err)
+	}
+	return reqs[0].ToRequest()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *method
+		wantErr string // substring of the error, or "" for success
+	}{
+		{"Simple", &method{Command: "true"}, ""},
+		{"Params", &method{
+			Command: `open -a "$app" -- ${path}`,
+			Params:  map[string]*param{"app": nil, "path": {Default: "."}},
+		}, ""},
+		{"Empty", &method{Command: ""}, "invalid command"},
+		{"BadQuote", &method{Command: `echo "open`}, "invalid command"},
+		{"ParamProgram", &method{
+			Command: "$prog --flag",
+			Params:  map[string]*param{"prog": nil},
+		}, "command name may not refer"},
+		{"ParamInProgram", &method{
+			Command: "/usr/bin/${prog}",
+			Params:  map[string]*param{"prog": nil},
+		}, "command name may not refer"},
+		{"UndefinedParam", &method{Command: "echo $x"}, "undefined parameter"},
+		{"UndefinedStdin", &method{Command: "cat", Stdin: "text"}, "stdin refers to undefined"},
+		{"BadType", &method{
+			Command: "echo $n",
+			Params:  map[string]*param{"n": {Type: "float"}},
+		}, "unknown type"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.m.check()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("check: unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("check: got %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	m := &method{
+		Command: "grep -e $pattern --count=$n $file",
+		Params: map[string]*param{
+			"pattern": {Required: true, AllowDash: true},
+			"file":    {Default: "input.txt"},
+			"n":       {Type: "int", Default: "1"},
+			"quiet":   {Type: "bool"},
+		},
+	}
+	if err := m.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		want   map[string]string // nil if an error is expected
+	}{
+		{"Defaults", `{"pattern":"x"}`,
+			map[string]string{"pattern": "x", "file": "input.txt", "n": "1", "quiet": ""}},
+		{"Typed", `{"pattern":"x","n":25,"quiet":true,"file":"a b"}`,
+			map[string]string{"pattern": "x", "file": "a b", "n": "25", "quiet": "true"}},
+		{"AllowDash", `{"pattern":"-v"}`,
+			map[string]string{"pattern": "-v", "file": "input.txt", "n": "1", "quiet": ""}},
+
+		// The value of n does not begin a word, so a leading dash is allowed.
+		{"DashInWord", `{"pattern":"x","n":-3}`,
+			map[string]string{"pattern": "x", "file": "input.txt", "n": "-3", "quiet": ""}},
+
+		{"LeadingDash", `{"pattern":"x","file":"-rf"}`, nil},
+		{"Missing", `{"file":"a"}`, nil},
+		{"NoParams", ``, nil},
+		{"Unknown", `{"pattern":"x","bogus":1}`, nil},
+		{"NotObject", `["x"]`, nil},
+		{"NotInt", `{"pattern":"x","n":"5"}`, nil},
+		{"NotBool", `{"pattern":"x","quiet":"yes"}`, nil},
+		{"NotString", `{"pattern":5}`, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := m.bind(request(t, tc.params))
+			if tc.want == nil {
+				if code := jrpc2.ErrorCode(err); code != jrpc2.InvalidParams {
+					t.Errorf("bind: got %v (code %v), want InvalidParams", err, code)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("bind: unexpected error: %v", err)
+			}
+			for name, want := range tc.want {
+				if got[name] != want {
+					t.Errorf("bind: %s = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+// newRunner returns a runner for the given methods, which must be valid.
+func newRunner(t *testing.T, methods map[string]*method) *runner {
+	t.Helper()
+	for name, m := range methods {
+		if err := m.check(); err != nil {
+			t.Fatalf("Method %q: %v", name, err)
+		}
+	}
+	return &runner{methods: methods}
+}
+
+func TestRun(t *testing.T) {
+	for _, prog := range []string{"printf", "sleep"} {
+		if _, err := exec.LookPath(prog); err != nil {
+			t.Skipf("Program %q not found", prog)
+		}
+	}
+	r := newRunner(t, map[string]*method{
+		"Args": {
+			Command: `printf "[%s]" x$word "$word" y`,
+			Params:  map[string]*param{"word": {Required: true}},
+			Output:  true,
+		},
+		"Slow": {Command: "sleep 5", Timeout: 50 * time.Millisecond},
+	})
+	ctx := context.Background()
+
+	// A value containing spaces and quotes is not split into words.
+	got, err := r.run(ctx, "Args", request(t, `{"word":"a b \"c\" $HOME"}`))
+	if err != nil {
+		t.Fatalf("Args: unexpected error: %v", err)
+	}
+	if want := `[xa b "c" $HOME][a b "c" $HOME][y]`; got != want {
+		t.Errorf("Args: got %#q, want %#q", got, want)
+	}
+
+	_, err = r.run(ctx, "Slow", request(t, ""))
+	if code := jrpc2.ErrorCode(err); code != jrpc2.DeadlineExceeded {
+		t.Errorf("Slow: got %v (code %v), want DeadlineExceeded", err, code)
+	}
+
+	_, err = r.run(ctx, "Nonesuch", request(t, ""))
+	if code := jrpc2.ErrorCode(err); code != jrpc2.MethodNotFound {
+		t.Errorf("Nonesuch: got %v (code %v), want MethodNotFound", err, code)
+	}
+}
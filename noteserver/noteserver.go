@@ -3,24 +3,34 @@
 // Usage:
 //
 //	noteserver -address :8080
+//
+// With -stdio, noteserver serves a single session on stdin and stdout instead
+// of listening, and exits when its input is closed. This is useful to run the
+// server over SSH, or from inetd or socat:
+//
+//	ssh host -- noteserver -config notifier.yml -stdio
+//
+// When started by systemd socket activation, noteserver serves on the sockets
+// it inherits. See notifier.NewServer for how they are matched to the
+// addresses in the configuration.
 package main
 
 import (
 	"context"
-	"expvar"
 	"flag"
 	"log"
-	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/creachadair/jrpc2"
-	"github.com/creachadair/jrpc2/channel"
-	"github.com/creachadair/jrpc2/server"
 	"github.com/creachadair/notifier"
 
 	// Install service plugins.
 	_ "github.com/creachadair/notifier/noteserver/clipper"
+	_ "github.com/creachadair/notifier/noteserver/command"
 	_ "github.com/creachadair/notifier/noteserver/poster"
 	_ "github.com/creachadair/notifier/noteserver/user"
 )
@@ -32,8 +42,8 @@ var (
 	configPath = flag.String("config", "", "Configuration file path")
 	serverAddr = flag.String("address", "", "Server address (overrides config)")
 	debugLog   = flag.Bool("debuglog", false, "Enable debug logging (overrides config)")
-
-	processID = new(expvar.Int)
+	drainTime  = flag.Duration("drain", 30*time.Second, "Wait this long for pending calls at shutdown")
+	stdioMode  = flag.Bool("stdio", false, "Serve a single session on stdin and stdout")
 )
 
 func main() {
@@ -50,30 +60,62 @@ func main() {
 		lw = jrpc2.StdLogger(log.New(os.Stderr, "[noteserver] ", log.LstdFlags))
 	}
 
-	atype, addr := jrpc2.Network(cfg.Address)
-	if atype == "unix" {
-		// Expand variables in a socket path, and unlink a stale socket in case
-		// one was left behind by a previous run.
-		addr = os.ExpandEnv(cfg.Address)
-		_ = os.Remove(addr) // it's fine if this fails
-	}
-	lst, err := net.Listen(atype, addr)
+	srv, err := notifier.NewServer(&cfg, &notifier.ServerOptions{
+		Logger:   lw,
+		NoListen: *stdioMode,
+	})
 	if err != nil {
-		log.Fatalf("Listen: %v", err)
+		log.Fatalf("Starting server: %v", err)
 	}
 
-	processID.Set(int64(os.Getpid()))
-	jrpc2.ServerMetrics().Set("noteserver_pid", processID)
+	// Reload the configuration when the server receives SIGHUP.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(srv); err != nil {
+				log.Printf("ERROR: reloading configuration: %v", err)
+			} else {
+				log.Printf("Reloaded configuration from %q", *configPath)
+			}
+		}
+	}()
+
+	// Shut down gracefully when the server receives SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdown := sync.OnceFunc(func() {
+		sctx, cancel := context.WithTimeout(context.Background(), *drainTime)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.Printf("ERROR: shutdown: %v", err)
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		log.Printf("Received signal; shutting down")
+		shutdown()
+	}()
 
-	ctx := context.Background()
-	acc := server.NetAccepter(lst, channel.Line)
-	service := server.Static(notifier.PluginAssigner(&cfg))
-	if err := server.Loop(ctx, acc, service, &server.LoopOptions{
-		ServerOptions: &jrpc2.ServerOptions{
-			Logger:    lw,
-			StartTime: time.Now().In(time.UTC),
-		},
-	}); err != nil {
+	if *stdioMode {
+		err := srv.ServeChannel(context.Background(), newStdioChannel(os.Stdin, os.Stdout), notifier.Peer{Network: "stdio"})
+		if err != nil && err != notifier.ErrServerClosed {
+			log.Printf("ERROR: session: %v", err)
+		}
+	} else if err := srv.Serve(context.Background()); err != notifier.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+	shutdown()
+}
+
+// reload loads the configuration file and delivers it to srv.
+func reload(srv *notifier.Server) error {
+	var next notifier.Config
+	if err := notifier.LoadConfig(*configPath, &next); err != nil {
+		return err
+	}
+	if *serverAddr != "" {
+		next.Address = *serverAddr
+	}
+	return srv.Reload(&next)
 }
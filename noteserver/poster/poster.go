@@ -3,10 +3,7 @@ package poster
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"os/exec"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/creachadair/jrpc2"
@@ -14,20 +11,46 @@ import (
 	"github.com/creachadair/notifier"
 )
 
-func init() { notifier.RegisterPlugin("Notify", new(poster)) }
+func init() { notifier.RegisterPlugin("Notify", New()) }
+
+// New constructs a new, uninitialized instance of the Notify plugin.
+func New() notifier.Plugin { return new(poster) }
 
 type poster struct {
-	cfg *notifier.Config
+	mu    sync.Mutex
+	cfg   *notifier.Config
+	post  notifier.Poster
+	voice notifier.Speaker
 }
 
 // Init implements part of notifier.Plugin.
-func (p *poster) Init(cfg *notifier.Config) error {
+func (p *poster) Init(cfg *notifier.Config) error { return p.Update(cfg) }
+
+// Update implements part of notifier.Plugin. It replaces the backends with
+// new ones constructed from cfg.
+func (p *poster) Update(cfg *notifier.Config) error {
+	post, err := cfg.Poster()
+	if err != nil {
+		return err
+	}
+	voice, err := cfg.Speaker()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.cfg = cfg
+	p.post = post
+	p.voice = voice
 	return nil
 }
 
-// Update implements part of notifier.Plugin. This implementation does nothing.
-func (*poster) Update() error { return nil }
+// current returns the current configuration and backends.
+func (p *poster) current() (*notifier.Config, notifier.Poster, notifier.Speaker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg, p.post, p.voice
+}
 
 // Assigner implements part of notifier.Plugin.
 func (p *poster) Assigner() handler.Map {
@@ -42,18 +65,6 @@ func (p *poster) Post(ctx context.Context, req *notifier.PostRequest) (bool, err
 	if req.Body == "" && req.Title == "" {
 		return false, jrpc2.Errorf(jrpc2.InvalidParams, "missing notification body and title")
 	}
-	program := []string{
-		fmt.Sprintf("display notification %q", req.Body),
-		fmt.Sprintf("with title %q", req.Title),
-	}
-	if t := req.Subtitle; t != "" {
-		program = append(program, fmt.Sprintf("subtitle %q", t))
-	}
-	if req.Audible {
-		program = append(program, fmt.Sprintf("sound name %q", p.cfg.Notify.Sound))
-	}
-	cmd := exec.CommandContext(ctx, "osascript")
-	cmd.Stdin = strings.NewReader(strings.Join(program, " "))
 	if wait := req.After; wait > 0 {
 		select {
 		case <-ctx.Done():
@@ -61,16 +72,18 @@ func (p *poster) Post(ctx context.Context, req *notifier.PostRequest) (bool, err
 		case <-time.After(req.After):
 		}
 	}
-	err := cmd.Run()
+	_, post, _ := p.current()
+	err := post.PostNotice(ctx, req)
 	return err == nil, err
 }
 
 // Say delivers a voice notification to the user.
 func (p *poster) Say(ctx context.Context, req *notifier.SayRequest) (bool, error) {
+	cfg, _, voice := p.current()
 	if req.Text == "" {
 		return false, jrpc2.Errorf(jrpc2.InvalidParams, "empty text")
 	} else if req.Voice == "" {
-		req.Voice = p.cfg.Notify.Voice
+		req.Voice = cfg.Notify.Voice
 	}
 	if wait := req.After; wait > 0 {
 		select {
@@ -79,9 +92,6 @@ func (p *poster) Say(ctx context.Context, req *notifier.SayRequest) (bool, error
 		case <-time.After(wait):
 		}
 	}
-	cmd := exec.CommandContext(ctx, "say", "-v", req.Voice)
-	cmd.Stdin = strings.NewReader(req.Text)
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	err := voice.Speak(ctx, req.Text, req.Voice)
 	return err == nil, err
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// A stdioChannel is a channel.Channel for a session on stdin and stdout.
+//
+// A read from stdin cannot be interrupted, so records are read by a separate
+// goroutine, and closing the channel does not wait for a pending read.
+//
+// When the input ends, Recv does not report EOF until a response has been
+// sent for each call received, so that a client may close its end of the
+// input once it has sent its requests.
+type stdioChannel struct {
+	ch   channel.Channel
+	recv chan record
+	wake chan struct{} // signaled when a response is sent
+	done chan struct{} // closed by Close
+
+	mu      sync.Mutex
+	pending int // calls received and not yet answered
+	closed  bool
+}
+
+type record struct {
+	data []byte
+	err  error
+}
+
+// newStdioChannel returns a channel that reads from in and writes to out,
+// which are normally os.Stdin and os.Stdout.
+func newStdioChannel(in io.Reader, out io.WriteCloser) *stdioChannel {
+	c := &stdioChannel{
+		ch:   channel.Line(in, out),
+		recv: make(chan record),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go func() {
+		for {
+			data, err := c.ch.Recv()
+			select {
+			case c.recv <- record{data, err}:
+			case <-c.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Send implements part of channel.Channel.
+func (c *stdioChannel) Send(data []byte) error {
+	err := c.ch.Send(data)
+	c.mu.Lock()
+	c.pending -= countMessages(data, false)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Recv implements part of channel.Channel.
+func (c *stdioChannel) Recv() ([]byte, error) {
+	select {
+	case <-c.done:
+		return nil, channel.ErrClosed
+	case r := <-c.recv:
+		if r.err == nil || (r.err == io.EOF && len(r.data) != 0) {
+			c.mu.Lock()
+			c.pending += countMessages(r.data, true)
+			c.mu.Unlock()
+			return r.data, nil
+		} else if r.err != io.EOF {
+			return nil, r.err
+		}
+	}
+
+	// The input has ended; wait for the pending calls to be answered.
+	for {
+		c.mu.Lock()
+		n := c.pending
+		c.mu.Unlock()
+		if n <= 0 {
+			return nil, io.EOF
+		}
+		select {
+		case <-c.done:
+			return nil, channel.ErrClosed
+		case <-c.wake:
+		}
+	}
+}
+
+// Close implements part of channel.Channel.
+func (c *stdioChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// countMessages reports the number of calls (if calls is true) or responses
+// (otherwise) in the JSON-RPC message or batch in data.
+func countMessages(data []byte, calls bool) int {
+	type message struct {
+		ID     json.RawMessage `json:"id"`
+		Method *string         `json:"method"`
+	}
+	var msgs []message
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if json.Unmarshal(data, &msgs) != nil {
+			return 0
+		}
+	} else {
+		var msg message
+		if json.Unmarshal(data, &msg) != nil {
+			return 0
+		}
+		msgs = append(msgs, msg)
+	}
+	var n int
+	for _, m := range msgs {
+		hasID := len(m.ID) != 0 && string(m.ID) != "null"
+		if hasID && (m.Method != nil) == calls {
+			n++
+		}
+	}
+	return n
+}
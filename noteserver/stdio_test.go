@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/handler"
+)
+
+func TestCountMessages(t *testing.T) {
+	tests := []struct {
+		data             string
+		calls, responses int
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"A"}`, 1, 0},
+		{`{"jsonrpc":"2.0","method":"A"}`, 0, 0},
+		{`{"jsonrpc":"2.0","id":null,"method":"A"}`, 0, 0},
+		{`{"jsonrpc":"2.0","id":"x","result":true}`, 0, 1},
+		{`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"bad"}}`, 0, 0},
+		{`[{"jsonrpc":"2.0","id":1,"method":"A"},{"jsonrpc":"2.0","method":"B"},` +
+			`{"jsonrpc":"2.0","id":2,"method":"C"}]`, 2, 0},
+		{`[{"jsonrpc":"2.0","id":1,"result":1},{"jsonrpc":"2.0","id":2,"error":{"code":1,"message":"x"}}]`, 0, 2},
+		{` [{"jsonrpc":"2.0","id":1,"method":"A"}]`, 1, 0},
+		{`[]`, 0, 0},
+		{`[{"jsonrpc":"2.0","id":1,"method":"A"}`, 0, 0},
+		{`not JSON`, 0, 0},
+	}
+	for _, tc := range tests {
+		if got := countMessages([]byte(tc.data), true); got != tc.calls {
+			t.Errorf("countMessages(%#q, true): got %d, want %d", tc.data, got, tc.calls)
+		}
+		if got := countMessages([]byte(tc.data), false); got != tc.responses {
+			t.Errorf("countMessages(%#q, false): got %d, want %d", tc.data, got, tc.responses)
+		}
+	}
+}
+
+func TestStdioDrain(t *testing.T) {
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	ch := newStdioChannel(inr, outw)
+	srv := jrpc2.NewServer(handler.Map{
+		"Notify.Post": handler.New(func(ctx context.Context) (bool, error) {
+			time.Sleep(100 * time.Millisecond)
+			return true, nil
+		}),
+	}, nil).Start(ch)
+
+	// The client sends a call and a notification, and closes its input
+	// before the call is answered.
+	go func() {
+		io.WriteString(inw, `{"jsonrpc":"2.0","id":1,"method":"Notify.Post"}`+"\n")
+		io.WriteString(inw, `{"jsonrpc":"2.0","method":"Notify.Post"}`+"\n")
+		inw.Close()
+	}()
+
+	line, err := bufio.NewReader(outr).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Reading reply: %v", err)
+	}
+	if want := `"id":1`; !strings.Contains(line, want) || !strings.Contains(line, `"result":true`) {
+		t.Errorf("Reply: got %#q, want a result for ID 1", line)
+	}
+
+	// Once the call is answered, the input is done and the server exits.
+	done := make(chan error, 1)
+	go func() { done <- srv.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Server exit: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not exit after its input ended")
+	}
+}
@@ -4,31 +4,49 @@ package user
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/jrpc2/handler"
 	"github.com/creachadair/notifier"
 )
 
-func init() { notifier.RegisterPlugin("User", new(input)) }
+func init() { notifier.RegisterPlugin("User", New()) }
+
+// New constructs a new, uninitialized instance of the User plugin.
+func New() notifier.Plugin { return new(input) }
 
 type input struct {
-	cfg *notifier.Config
+	mu     sync.Mutex
+	cfg    *notifier.Config
+	dialog notifier.Dialog
 }
 
 // Init implements part of notifier.Plugin.
-func (u *input) Init(cfg *notifier.Config) error {
+func (u *input) Init(cfg *notifier.Config) error { return u.Update(cfg) }
+
+// Update implements part of notifier.Plugin. It replaces the dialog backend
+// with a new one constructed from cfg.
+func (u *input) Update(cfg *notifier.Config) error {
+	dialog, err := cfg.Dialog()
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	u.cfg = cfg
+	u.dialog = dialog
 	return nil
 }
 
-// Update implements part of notifier.Plugin.
-func (*input) Update() error { return nil }
+// current returns the current configuration and dialog backend.
+func (u *input) current() (*notifier.Config, notifier.Dialog) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.cfg, u.dialog
+}
 
 // Assigner implements part of notifier.Plugin.
 func (u *input) Assigner() handler.Map {
@@ -43,31 +61,14 @@ func (u *input) Text(ctx context.Context, req *notifier.TextRequest) (string, er
 	if req.Prompt == "" {
 		return "", jrpc2.Errorf(jrpc2.InvalidParams, "missing prompt string")
 	}
-
-	// Ask osascript to send error text to stdout to simplify error plumbing.
-	cmd := exec.Command("osascript", "-s", "ho")
-	cmd.Stdin = strings.NewReader(fmt.Sprintf(`display dialog %q default answer %q hidden answer %v`,
-		req.Prompt, req.Default, req.Hide))
-	raw, err := cmd.Output()
-	out := strings.TrimRight(string(raw), "\n")
-	if err != nil {
-		if strings.Contains(out, "User canceled") {
-			return "", jrpc2.Errorf(notifier.UserCancelled, "user cancelled request")
-		}
-		return "", err
-	}
-
-	// Parse the result out of the text delivered to stdout.
-	const needle = "text returned:"
-	if _, after, ok := strings.Cut(out, needle); ok {
-		return after, nil
-	}
-	return "", jrpc2.Errorf(jrpc2.InternalError, "missing user input")
+	_, dialog := u.current()
+	return dialog.PromptText(ctx, req)
 }
 
 // Edit opens the designated editor for a file.
 func (u *input) Edit(ctx context.Context, req *notifier.EditRequest) ([]byte, error) {
-	if u.cfg.Edit.Command == "" {
+	cfg, _ := u.current()
+	if cfg.Edit.Command == "" && cfg.Edit.Editor == nil {
 		return nil, errors.New("no editor is defined")
 	} else if req.Name == "" {
 		return nil, jrpc2.Errorf(jrpc2.InvalidParams, "missing file name")
@@ -84,7 +85,7 @@ func (u *input) Edit(ctx context.Context, req *notifier.EditRequest) ([]byte, er
 	path := filepath.Join(tmp, req.Name)
 	if err := os.WriteFile(path, req.Content, 0644); err != nil {
 		return nil, err
-	} else if err := u.cfg.EditFile(ctx, path); err != nil {
+	} else if err := cfg.EditFile(ctx, path); err != nil {
 		return nil, err
 	}
 	return os.ReadFile(path)
@@ -0,0 +1,116 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A Poster is a backend that displays notifications to the user.
+type Poster interface {
+	// PostNotice displays the notification described by req.  The caller is
+	// responsible for any delay requested by req.After.
+	PostNotice(ctx context.Context, req *PostRequest) error
+}
+
+// Poster returns the notification backend selected by the configuration.  If
+// c.Notify.Poster is set, it is returned; otherwise a new backend is created as
+// specified by c.Notify.Backend.
+func (c *Config) Poster() (Poster, error) {
+	if c.Notify.Poster != nil {
+		return c.Notify.Poster, nil
+	}
+	switch c.Notify.Backend {
+	case "", "osascript":
+		return osaPoster{sound: c.Notify.Sound}, nil
+	case "notify-send":
+		return notifySendPoster{sound: c.Notify.Sound}, nil
+	case "log":
+		return logPoster{path: os.ExpandEnv(c.Notify.LogFile)}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification backend %q", c.Notify.Backend)
+	}
+}
+
+// osaPoster posts notifications using the macOS notification center, via the
+// AppleScript "display notification" command.
+type osaPoster struct{ sound string }
+
+func (o osaPoster) PostNotice(ctx context.Context, req *PostRequest) error {
+	program := []string{
+		fmt.Sprintf("display notification %q", req.Body),
+		fmt.Sprintf("with title %q", req.Title),
+	}
+	if t := req.Subtitle; t != "" {
+		program = append(program, fmt.Sprintf("subtitle %q", t))
+	}
+	if req.Audible {
+		program = append(program, fmt.Sprintf("sound name %q", o.sound))
+	}
+	cmd := exec.CommandContext(ctx, "osascript")
+	cmd.Stdin = strings.NewReader(strings.Join(program, " "))
+	return cmd.Run()
+}
+
+// notifySendPoster posts notifications to a freedesktop.org notification
+// daemon using the notify-send command.
+type notifySendPoster struct{ sound string }
+
+func (n notifySendPoster) PostNotice(ctx context.Context, req *PostRequest) error {
+	// The freedesktop.org protocol has no subtitle, so put it on the first line
+	// of the body. A summary is required, so promote the body if it is empty.
+	summary, body := req.Title, req.Body
+	if t := req.Subtitle; t != "" {
+		body = strings.TrimSuffix(t+"\n"+body, "\n")
+	}
+	if summary == "" {
+		summary, body = body, ""
+	}
+	args := []string{"--app-name=noteserver"}
+	if req.Audible {
+		sound := n.sound
+		if sound == "" {
+			sound = "message-new-instant"
+		}
+		args = append(args, "--hint=string:sound-name:"+sound)
+	}
+	args = append(args, "--", summary)
+	if body != "" {
+		args = append(args, body)
+	}
+	return exec.CommandContext(ctx, "notify-send", args...).Run()
+}
+
+// logPoster records notifications as lines of text appended to a file.
+// If path is empty, notifications are written to the standard logger.
+type logPoster struct{ path string }
+
+func (p logPoster) PostNotice(_ context.Context, req *PostRequest) error {
+	msg := req.Title
+	if t := req.Subtitle; t != "" {
+		msg += " [" + t + "]"
+	}
+	if req.Body != "" {
+		msg += ": " + req.Body
+	}
+	if req.Audible {
+		msg += " (audible)"
+	}
+	if p.path == "" {
+		log.Printf("Notice: %s", msg)
+		return nil
+	}
+	f, err := os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s %s\n", time.Now().Format(time.RFC3339), msg)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -3,12 +3,15 @@ package notifier
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -18,6 +21,13 @@ import (
 
 var (
 	serverAddr = os.Getenv("NOTIFIER_ADDR") // see RegisterFlags
+	tokenFile  = os.Getenv("NOTIFIER_TOKEN_FILE")
+
+	// TLS settings for the client; see RegisterFlags.
+	tlsCA         = os.Getenv("NOTIFIER_TLS_CA")
+	tlsCert       = os.Getenv("NOTIFIER_TLS_CERT")
+	tlsKey        = os.Getenv("NOTIFIER_TLS_KEY")
+	tlsServerName = os.Getenv("NOTIFIER_TLS_SERVER_NAME")
 
 	debug jrpc2.Logger
 )
@@ -29,21 +39,48 @@ func init() {
 	}
 }
 
-// RegisterFlags installs a standard -server flag in the default flagset.
+// RegisterFlags installs a standard -server flag in the default flagset,
+// along with flags for the TLS settings of the client. The TLS flags default
+// to the values of the corresponding NOTIFIER_TLS_* environment variables.
 // This function should be called during init in a client main package.
 func RegisterFlags() {
 	flag.StringVar(&serverAddr, "server", serverAddr, "Server address")
+	flag.StringVar(&tlsCA, "tls-ca", tlsCA, "TLS: verify the server with these CA certificates")
+	flag.StringVar(&tlsCert, "tls-cert", tlsCert, "TLS: client certificate file")
+	flag.StringVar(&tlsKey, "tls-key", tlsKey, "TLS: client key file (default: -tls-cert)")
+	flag.StringVar(&tlsServerName, "tls-server-name", tlsServerName, "TLS: expected server name")
 }
 
 // Dial connects to the flag-selected JSON-RPC server and returns a context and
 // a client ready for use. The caller is responsible for closing the client.
+//
+// If a CA, client certificate, or server name is set for TLS, Dial connects
+// using TLS. If the NOTIFIER_TOKEN environment variable is set, or
+// NOTIFIER_TOKEN_FILE names a file containing a token, Dial authenticates the
+// connection with that token before returning.
 func Dial(ctx context.Context) (context.Context, *jrpc2.Client, error) {
+	token, err := clientToken()
+	if err != nil {
+		return ctx, nil, err
+	}
+
 	// Dial the server: host:port is tcp, otherwise a Unix socket.
 	atype, addr := jrpc2.Network(serverAddr)
 	if atype == "unix" {
 		addr = os.ExpandEnv(addr)
 	}
-	conn, err := net.Dial(atype, addr)
+	tc, err := clientTLS(addr)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("TLS settings: %w", err)
+	}
+	var conn net.Conn
+	if tc != nil {
+		d := &tls.Dialer{Config: tc}
+		conn, err = d.DialContext(ctx, atype, addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, atype, addr)
+	}
 	if err != nil {
 		return ctx, nil, fmt.Errorf("address %q: %v", addr, err)
 	}
@@ -51,9 +88,30 @@ func Dial(ctx context.Context) (context.Context, *jrpc2.Client, error) {
 	cli := jrpc2.NewClient(channel.Line(conn, conn), &jrpc2.ClientOptions{
 		Logger: debug,
 	})
+	if token != "" {
+		if _, err := cli.Call(ctx, "Session.Auth", &AuthRequest{Token: token}); err != nil {
+			cli.Close()
+			return ctx, nil, fmt.Errorf("authenticating: %w", err)
+		}
+	}
 	return ctx, cli, nil
 }
 
+// clientToken returns the authentication token for the client, if any.
+func clientToken() (string, error) {
+	if token := os.Getenv("NOTIFIER_TOKEN"); token != "" {
+		return token, nil
+	} else if tokenFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(os.ExpandEnv(tokenFile))
+	if err != nil {
+		return "", fmt.Errorf("reading token: %w", err)
+	}
+	token, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(token), nil
+}
+
 // A PostRequest is a request to post a notification to the user.
 type PostRequest struct {
 	Title    string        `json:"title,omitempty"`
@@ -112,6 +170,42 @@ func (TextRequest) DisallowUnknownFields() {}
 // UserCancelled is the code returned when a user cancels a text request.
 const UserCancelled = jrpc2.Code(-29999)
 
+// Unauthorized is the code returned when a client calls a method without
+// authenticating, or presents an invalid token.
+const Unauthorized = jrpc2.Code(-29997)
+
+// Forbidden is the code returned when a client calls a method that the access
+// control rules of the server do not permit it to call.
+const Forbidden = jrpc2.Code(-29996)
+
+// An AuthRequest is a request to authenticate a connection with a token.
+type AuthRequest struct {
+	Token string `json:"token"`
+}
+
+func (AuthRequest) DisallowUnknownFields() {}
+
+// A ForwardRequest is a request to handle a call forwarded by another server.
+// Servers send it to the Session.Forward method of their upstream server,
+// which accepts it only from the clients named by its Downstream setting.
+type ForwardRequest struct {
+	// The method and parameters of the original call.
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+
+	// The servers that have forwarded the call, beginning with the server
+	// nearest to the original client.
+	Via []Hop `json:"via"`
+}
+
+func (ForwardRequest) DisallowUnknownFields() {}
+
+// A Hop records a server that forwarded a call.
+type Hop struct {
+	Server string `json:"server"` // the name of the server
+	Client string `json:"client"` // the client from which the server received the call
+}
+
 // An EditRequest is a request to edit the contents of a file.
 type EditRequest struct {
 	// The base name of the file to edit.
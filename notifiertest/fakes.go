@@ -0,0 +1,202 @@
+package notifiertest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/notifier"
+)
+
+// Clipboard is a fake notifier.Clipboard that stores its contents in memory
+// and records the values written to it.
+type Clipboard struct {
+	mu   sync.Mutex
+	data []byte
+	sets [][]byte
+	err  error
+}
+
+// GetClipboard implements part of notifier.Clipboard.
+func (c *Clipboard) GetClipboard(context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return bytes.Clone(c.data), nil
+}
+
+// SetClipboard implements part of notifier.Clipboard.
+func (c *Clipboard) SetClipboard(_ context.Context, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.data = bytes.Clone(data)
+	c.sets = append(c.sets, c.data)
+	return nil
+}
+
+// Contents returns the current contents of the clipboard.
+func (c *Clipboard) Contents() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.data)
+}
+
+// Sets returns the values written to the clipboard, in order.
+func (c *Clipboard) Sets() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.sets...)
+}
+
+// Fail causes subsequent clipboard operations to report err.
+// Passing nil restores normal operation.
+func (c *Clipboard) Fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Poster is a fake notifier.Poster that records the notifications posted.
+type Poster struct {
+	mu     sync.Mutex
+	posted []notifier.PostRequest
+	err    error
+}
+
+// PostNotice implements notifier.Poster.
+func (p *Poster) PostNotice(_ context.Context, req *notifier.PostRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.posted = append(p.posted, *req)
+	return nil
+}
+
+// Posted returns the notifications posted, in order.
+func (p *Poster) Posted() []notifier.PostRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]notifier.PostRequest(nil), p.posted...)
+}
+
+// Fail causes subsequent notifications to report err.
+// Passing nil restores normal operation.
+func (p *Poster) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Dialog is a fake notifier.Dialog that replies to prompts from a script of
+// responses. When the script is empty, it replies with the default answer.
+type Dialog struct {
+	mu      sync.Mutex
+	prompts []notifier.TextRequest
+	script  []func() (string, error)
+}
+
+// PromptText implements notifier.Dialog.
+func (d *Dialog) PromptText(_ context.Context, req *notifier.TextRequest) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prompts = append(d.prompts, *req)
+	if len(d.script) == 0 {
+		return req.Default, nil
+	}
+	next := d.script[0]
+	d.script = d.script[1:]
+	return next()
+}
+
+// Respond adds a reply of text to the script.
+func (d *Dialog) Respond(text string) {
+	d.push(func() (string, error) { return text, nil })
+}
+
+// Cancel adds a reply to the script that simulates the user cancelling.
+func (d *Dialog) Cancel() {
+	d.push(func() (string, error) {
+		return "", jrpc2.Errorf(notifier.UserCancelled, "user cancelled request")
+	})
+}
+
+// Fail adds a reply to the script that reports err.
+func (d *Dialog) Fail(err error) {
+	d.push(func() (string, error) { return "", err })
+}
+
+func (d *Dialog) push(f func() (string, error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.script = append(d.script, f)
+}
+
+// Prompts returns the requests received by the dialog, in order.
+func (d *Dialog) Prompts() []notifier.TextRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]notifier.TextRequest(nil), d.prompts...)
+}
+
+// Editor is a fake notifier.Editor that edits files according to a script of
+// edit functions. When the script is empty, files are left unchanged.
+type Editor struct {
+	mu     sync.Mutex
+	edited [][]byte
+	script []func([]byte) ([]byte, error)
+}
+
+// EditFile implements notifier.Editor.
+func (e *Editor) EditFile(_ context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.edited = append(e.edited, data)
+	var edit func([]byte) ([]byte, error)
+	if len(e.script) != 0 {
+		edit = e.script[0]
+		e.script = e.script[1:]
+	}
+	e.mu.Unlock()
+
+	if edit == nil {
+		return nil
+	}
+	out, err := edit(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// Edit adds an edit to the script that replaces the contents of the file with
+// the result of calling f on its current contents.
+func (e *Editor) Edit(f func([]byte) ([]byte, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.script = append(e.script, f)
+}
+
+// Replace adds an edit to the script that replaces the contents of the file
+// with data.
+func (e *Editor) Replace(data []byte) {
+	e.Edit(func([]byte) ([]byte, error) { return data, nil })
+}
+
+// Edited returns the original contents of each file edited, in order.
+func (e *Editor) Edited() [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([][]byte(nil), e.edited...)
+}
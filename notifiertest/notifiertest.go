@@ -0,0 +1,190 @@
+// Package notifiertest provides an in-process notifier server with fake
+// backends, for testing programs that call the noteserver methods. A NetServer
+// serves the same plugins over a loopback listener, for testing clients and
+// settings that depend on the transport, such as authentication.
+//
+// Example:
+//
+//	s := notifiertest.NewServer(nil)
+//	defer s.Close()
+//
+//	s.Dialog.Respond("hunter2")
+//	var text string
+//	err := s.Client.CallResult(ctx, "User.Text", &notifier.TextRequest{
+//	   Prompt: "Password", Hide: true,
+//	}, &text)
+package notifiertest
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/jrpc2/server"
+	"github.com/creachadair/notifier"
+	"github.com/creachadair/notifier/noteserver/clipper"
+	"github.com/creachadair/notifier/noteserver/poster"
+	"github.com/creachadair/notifier/noteserver/user"
+)
+
+// A Server is an in-process notifier server whose plugins use fake backends.
+// The fields are ready for use after NewServer returns.
+type Server struct {
+	// A client connected to the server.
+	Client *jrpc2.Client
+
+	// The configuration used to initialize the plugins.
+	Config *notifier.Config
+
+	// The registry containing the plugins served.
+	Registry *notifier.Registry
+
+	Fakes
+
+	local server.Local
+}
+
+// Fakes are the fake backends used by the plugins of a test server.
+type Fakes struct {
+	Clipboard *Clipboard                 // used by the Clip service
+	Poster    *Poster                    // used by Notify.Post
+	Speaker   *notifier.RecordingSpeaker // used by Notify.Say
+	Dialog    *Dialog                    // used by User.Text
+	Editor    *Editor                    // used by User.Edit
+}
+
+func newFakes() Fakes {
+	return Fakes{
+		Clipboard: new(Clipboard),
+		Poster:    new(Poster),
+		Speaker:   new(notifier.RecordingSpeaker),
+		Dialog:    new(Dialog),
+		Editor:    new(Editor),
+	}
+}
+
+// config returns a copy of cfg with the backends replaced by f. If cfg == nil,
+// default settings are used.
+func (f Fakes) config(cfg *notifier.Config) *notifier.Config {
+	out := new(notifier.Config)
+	if cfg != nil {
+		*out = *cfg
+	}
+	out.Clip.Clipboard = f.Clipboard
+	out.Notify.Poster = f.Poster
+	out.Notify.Speaker = f.Speaker
+	out.User.Dialog = f.Dialog
+	out.Edit.Editor = f.Editor
+	return out
+}
+
+// newRegistry returns a registry of new instances of the standard plugins.
+func newRegistry() *notifier.Registry {
+	reg := notifier.NewRegistry()
+	reg.Register("Clip", clipper.New())
+	reg.Register("Notify", poster.New())
+	reg.Register("User", user.New())
+	return reg
+}
+
+// NewServer starts a server for new instances of the standard plugins using a
+// copy of cfg, with the backends replaced by fakes. If cfg == nil, default
+// settings are used. The caller must close the server when it is no longer
+// needed. NewServer panics if the plugins cannot be initialized.
+func NewServer(cfg *notifier.Config) *Server {
+	s := &Server{Fakes: newFakes(), Registry: newRegistry()}
+	s.Config = s.Fakes.config(cfg)
+	svc, err := s.Registry.Init(s.Config)
+	if err != nil {
+		panic(err)
+	}
+	s.local = server.NewLocal(svc, nil)
+	s.Client = s.local.Client
+	return s
+}
+
+// Close shuts down the client and the server, and reports the exit status of
+// the server.
+func (s *Server) Close() error {
+	err := s.local.Close()
+	s.Registry.Shutdown(context.Background())
+	return err
+}
+
+// A NetServer is a notifier.Server whose plugins use fake backends, listening
+// on a local TCP address. Unlike a Server, it applies the authentication,
+// access control, and HTTP settings of its configuration to its clients.  The
+// fields are ready for use after NewNetServer returns.
+type NetServer struct {
+	// The address of the server, host:port.
+	Addr string
+
+	// The server, which is serving connections.
+	Server *notifier.Server
+
+	// The configuration used to start the server.
+	Config *notifier.Config
+
+	// The registry containing the plugins served.
+	Registry *notifier.Registry
+
+	Fakes
+
+	errc chan error
+}
+
+// NewNetServer starts a server for new instances of the standard plugins on a
+// loopback address, using a copy of cfg with the backends replaced by fakes.
+// The addresses in cfg are not used. If cfg == nil, default settings are used.
+// The caller must close the server when it is no longer needed. NewNetServer
+// panics if the server cannot be started.
+func NewNetServer(cfg *notifier.Config) *NetServer {
+	s := &NetServer{Fakes: newFakes(), Registry: newRegistry(), errc: make(chan error, 1)}
+	s.Config = s.Fakes.config(cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s.Addr = ln.Addr().String()
+	s.Server, err = notifier.NewServer(s.Config, &notifier.ServerOptions{
+		Listeners: []net.Listener{ln},
+		Registry:  s.Registry,
+	})
+	if err != nil {
+		ln.Close()
+		panic(err)
+	}
+	go func() { s.errc <- s.Server.Serve(context.Background()) }()
+	return s
+}
+
+// Dial returns a new client connected to s.
+func (s *NetServer) Dial() (*jrpc2.Client, error) {
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return jrpc2.NewClient(channel.Line(conn, conn), nil), nil
+}
+
+// Reload reloads s with a copy of cfg, with the backends replaced by the
+// fakes of s.
+func (s *NetServer) Reload(cfg *notifier.Config) error {
+	cfg = s.Fakes.config(cfg)
+	if err := s.Server.Reload(cfg); err != nil {
+		return err
+	}
+	s.Config = cfg
+	return nil
+}
+
+// Close shuts down the server, and reports the exit status of the server.
+func (s *NetServer) Close() error {
+	s.Server.Shutdown(context.Background())
+	if err := <-s.errc; !errors.Is(err, notifier.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package notifiertest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/notifier"
+	"github.com/creachadair/notifier/notifiertest"
+)
+
+func newServer(t *testing.T, cfg *notifier.Config) *notifiertest.Server {
+	t.Helper()
+	s := notifiertest.NewServer(cfg)
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Server close: %v", err)
+		}
+	})
+	return s
+}
+
+func call(t *testing.T, s *notifiertest.Server, method string, params, result any) error {
+	t.Helper()
+	return s.Client.CallResult(context.Background(), method, params, result)
+}
+
+func TestNotify(t *testing.T) {
+	cfg := new(notifier.Config)
+	cfg.Notify.Voice = "Moira"
+	s := newServer(t, cfg)
+
+	var ok bool
+	if err := call(t, s, "Notify.Post", &notifier.PostRequest{Title: "T", Body: "hello"}, &ok); err != nil {
+		t.Fatalf("Notify.Post: %v", err)
+	}
+	if got := s.Poster.Posted(); len(got) != 1 || got[0].Title != "T" || got[0].Body != "hello" {
+		t.Errorf("Posted: got %+v, want one notification", got)
+	}
+	s.Poster.Fail(errors.New("no display"))
+	if err := call(t, s, "Notify.Post", &notifier.PostRequest{Body: "again"}, &ok); err == nil {
+		t.Error("Notify.Post with failing poster: got nil error")
+	}
+
+	// An empty voice selects the configured default.
+	for _, req := range []*notifier.SayRequest{{Text: "one"}, {Text: "two", Voice: "Fred"}} {
+		if err := call(t, s, "Notify.Say", req, &ok); err != nil {
+			t.Fatalf("Notify.Say: %v", err)
+		}
+	}
+	want := []notifier.Utterance{{Text: "one", Voice: "Moira"}, {Text: "two", Voice: "Fred"}}
+	if got := s.Speaker.Utterances(); !slices.Equal(got, want) {
+		t.Errorf("Utterances: got %+v, want %+v", got, want)
+	}
+}
+
+func TestDialog(t *testing.T) {
+	s := newServer(t, nil)
+	prompt := func(req *notifier.TextRequest) (string, error) {
+		var text string
+		err := call(t, s, "User.Text", req, &text)
+		return text, err
+	}
+
+	s.Dialog.Respond("hunter2")
+	s.Dialog.Cancel()
+	s.Dialog.Fail(errors.New("no terminal"))
+
+	if got, err := prompt(&notifier.TextRequest{Prompt: "Password", Hide: true}); err != nil || got != "hunter2" {
+		t.Errorf("Respond: got %q, %v; want hunter2", got, err)
+	}
+	if _, err := prompt(&notifier.TextRequest{Prompt: "Name"}); jrpc2.ErrorCode(err) != notifier.UserCancelled {
+		t.Errorf("Cancel: got %v, want code UserCancelled", err)
+	}
+	if _, err := prompt(&notifier.TextRequest{Prompt: "Name"}); err == nil {
+		t.Error("Fail: got nil error")
+	}
+
+	// When the script is exhausted, the default is returned.
+	if got, err := prompt(&notifier.TextRequest{Prompt: "Color", Default: "blue"}); err != nil || got != "blue" {
+		t.Errorf("Default: got %q, %v; want blue", got, err)
+	}
+
+	var prompts []string
+	for _, req := range s.Dialog.Prompts() {
+		prompts = append(prompts, req.Prompt)
+	}
+	if want := []string{"Password", "Name", "Name", "Color"}; !slices.Equal(prompts, want) {
+		t.Errorf("Prompts: got %q, want %q", prompts, want)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	s := newServer(t, nil)
+	edit := func(content string) (string, error) {
+		var out []byte
+		err := call(t, s, "User.Edit", &notifier.EditRequest{Name: "notes.txt", Content: []byte(content)}, &out)
+		return string(out), err
+	}
+
+	s.Editor.Replace([]byte("replaced"))
+	s.Editor.Edit(func(data []byte) ([]byte, error) { return append(data, " and more"...), nil })
+	s.Editor.Edit(func([]byte) ([]byte, error) { return nil, errors.New("editor crashed") })
+
+	for _, tc := range []struct {
+		input, want string
+	}{
+		{"first", "replaced"},
+		{"second", "second and more"},
+	} {
+		if got, err := edit(tc.input); err != nil || got != tc.want {
+			t.Errorf("Edit %q: got %q, %v; want %q", tc.input, got, err, tc.want)
+		}
+	}
+	if _, err := edit("third"); err == nil {
+		t.Error("Edit with failing editor: got nil error")
+	}
+
+	// When the script is exhausted, the file is unchanged.
+	if got, err := edit("fourth"); err != nil || got != "fourth" {
+		t.Errorf("Edit: got %q, %v; want fourth", got, err)
+	}
+
+	var edited []string
+	for _, data := range s.Editor.Edited() {
+		edited = append(edited, string(data))
+	}
+	if want := []string{"first", "second", "third", "fourth"}; !slices.Equal(edited, want) {
+		t.Errorf("Edited: got %q, want %q", edited, want)
+	}
+}
+
+func TestClip(t *testing.T) {
+	s := newServer(t, nil)
+	set := func(req *notifier.ClipSetRequest) {
+		t.Helper()
+		var ok bool
+		if err := call(t, s, "Clip.Set", req, &ok); err != nil {
+			t.Fatalf("Clip.Set: %v", err)
+		}
+	}
+	get := func(req *notifier.ClipGetRequest) string {
+		t.Helper()
+		var data []byte
+		if err := call(t, s, "Clip.Get", req, &data); err != nil {
+			t.Fatalf("Clip.Get: %v", err)
+		}
+		return string(data)
+	}
+	checkActive := func(want string) {
+		t.Helper()
+		if got := string(s.Clipboard.Contents()); got != want {
+			t.Errorf("Clipboard: got %q, want %q", got, want)
+		}
+	}
+
+	set(&notifier.ClipSetRequest{Data: []byte("one"), Tag: "a"})
+	checkActive("one")
+
+	// Saving stores the active clip before replacing it.
+	set(&notifier.ClipSetRequest{Data: []byte("two"), Save: "prev"})
+	checkActive("two")
+	if got := get(&notifier.ClipGetRequest{Tag: "prev"}); got != "one" {
+		t.Errorf("Get prev: got %q, want one", got)
+	}
+
+	// Activating a clip makes it active, after saving the active clip.
+	if got := get(&notifier.ClipGetRequest{Tag: "a", Activate: true, Save: "b"}); got != "one" {
+		t.Errorf("Get a: got %q, want one", got)
+	}
+	checkActive("one")
+	if got := get(&notifier.ClipGetRequest{Tag: "b"}); got != "two" {
+		t.Errorf("Get b: got %q, want two", got)
+	}
+
+	var tags []string
+	if err := call(t, s, "Clip.List", nil, &tags); err != nil {
+		t.Fatalf("Clip.List: %v", err)
+	}
+	if want := []string{"a", "active", "b", "prev"}; !slices.Equal(tags, want) {
+		t.Errorf("Clip.List: got %q, want %q", tags, want)
+	}
+
+	var sets []string
+	for _, data := range s.Clipboard.Sets() {
+		sets = append(sets, string(data))
+	}
+	if want := []string{"one", "two", "one"}; !slices.Equal(sets, want) {
+		t.Errorf("Sets: got %q, want %q", sets, want)
+	}
+
+	s.Clipboard.Fail(errors.New("no clipboard"))
+	var data []byte
+	if err := call(t, s, "Clip.Get", &notifier.ClipGetRequest{}, &data); err == nil {
+		t.Error("Clip.Get with failing clipboard: got nil error")
+	}
+}
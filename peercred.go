@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+)
+
+// PeerCred records the credentials of the process on the other end of a
+// Unix-domain socket connection.
+type PeerCred struct {
+	UID, GID, PID int
+}
+
+// unixPeerCred returns the credentials of the peer of conn, or nil if conn is
+// not a Unix-domain socket or the platform does not report credentials.
+func unixPeerCred(conn net.Conn) (*PeerCred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *PeerCred
+	var cerr error
+	if err := raw.Control(func(fd uintptr) { cred, cerr = peerCred(int(fd)) }); err != nil {
+		return nil, err
+	}
+	return cred, cerr
+}
+
+// uidAllowed reports whether a client with the given credentials may connect
+// when the allowed uids are restricted to allow. If allow is empty, all
+// clients are allowed. Otherwise, the client's uid must be known and either
+// listed in allow or the same as the uid of the server.
+func uidAllowed(allow []int, cred *PeerCred) bool {
+	if len(allow) == 0 {
+		return true
+	} else if cred == nil {
+		return false
+	}
+	return cred.UID == os.Getuid() || slices.Contains(allow, cred.UID)
+}
+
+// setupSocket applies the permission settings of c to the socket at path,
+// which must not yet be accessible to other users. If c does not set a mode,
+// the socket is given defaultMode.
+func (c *Config) setupSocket(path string, defaultMode os.FileMode) error {
+	mode, gid, err := c.socketPerms()
+	if err != nil {
+		return err
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			return err
+		}
+	}
+	if mode == 0 {
+		mode = defaultMode
+	}
+	return os.Chmod(path, mode)
+}
+
+// socketPerms returns the permission bits and group ID for the socket selected
+// by c. It returns a zero mode and a gid of -1 for settings that are not set.
+func (c *Config) socketPerms() (os.FileMode, int, error) {
+	var mode os.FileMode
+	if c.Socket.Mode != "" {
+		m, err := strconv.ParseUint(c.Socket.Mode, 8, 32)
+		if err != nil || m&^0777 != 0 {
+			return 0, -1, fmt.Errorf("invalid socket mode %q", c.Socket.Mode)
+		}
+		mode = os.FileMode(m)
+	}
+	gid := -1
+	if g := c.Socket.Group; g != "" {
+		if n, err := strconv.Atoi(g); err == nil {
+			gid = n
+		} else if grp, err := user.LookupGroup(g); err != nil {
+			return 0, -1, err
+		} else if gid, err = strconv.Atoi(grp.Gid); err != nil {
+			return 0, -1, fmt.Errorf("group %q: invalid gid %q", g, grp.Gid)
+		}
+	}
+	return mode, gid, nil
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+
+package notifier
+
+import "golang.org/x/sys/unix"
+
+func peerCred(fd int) (*PeerCred, error) {
+	xc, err := unix.GetsockoptXucred(fd, unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := unix.GetsockoptInt(fd, unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	if err != nil {
+		return nil, err
+	}
+	cred := &PeerCred{UID: int(xc.Uid), GID: -1, PID: pid}
+	if xc.Ngroups > 0 {
+		cred.GID = int(xc.Groups[0])
+	}
+	return cred, nil
+}
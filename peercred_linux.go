@@ -0,0 +1,13 @@
+//go:build linux
+
+package notifier
+
+import "golang.org/x/sys/unix"
+
+func peerCred(fd int) (*PeerCred, error) {
+	uc, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return nil, err
+	}
+	return &PeerCred{UID: int(uc.Uid), GID: int(uc.Gid), PID: int(uc.Pid)}, nil
+}
@@ -0,0 +1,6 @@
+//go:build !linux && !darwin
+
+package notifier
+
+// peerCred is not supported on this platform.
+func peerCred(int) (*PeerCred, error) { return nil, nil }
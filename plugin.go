@@ -1,17 +1,16 @@
 package notifier
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
-	"os/exec"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/jrpc2/handler"
@@ -24,61 +23,216 @@ var ResourceNotFound = jrpc2.Code(-29998)
 // cannot be used with the given configuration.
 var ErrNotApplicable = errors.New("plugin is not applicable")
 
+// initShutdownTimeout bounds the time Init waits for plugins it has already
+// initialized to shut down, when a later plugin fails.
+const initShutdownTimeout = 5 * time.Second
+
 // A Plugin exposes a set of methods.
 type Plugin interface {
 	// Init is called once before any other methods of the plugin are used, with
 	// a pointer to the shared configuration.
 	Init(*Config) error
 
-	// Update may be called periodically to give the plugin an opportunity to
-	// update its state.
-	Update() error
-
 	// Assigner returns an assigner for handlers.
 	Assigner() handler.Map
 }
 
-var plugins = make(map[string]Plugin)
-var setup sync.Once
+// An Updater is a Plugin that can apply a reloaded configuration. If a plugin
+// implements this interface, its Update method is called with a pointer to
+// the new configuration when the configuration of its registry is updated.
+// The plugin should either apply the new settings completely or report an
+// error and retain its existing state.
+type Updater interface {
+	Update(*Config) error
+}
 
-// RegisterPlugin registers a plugin. This function will panic if the same name
+// A Shutdowner is a Plugin that has state to clean up when it is no longer in
+// use. If a plugin implements this interface, its Shutdown method is called
+// when its registry is shut down, after all pending calls have finished.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// A Registry manages a collection of named plugins. A zero Registry is empty
+// and ready for use. Each plugin value should be registered with at most one
+// registry, since the registry initializes it with its own configuration.
+type Registry struct {
+	mu      sync.Mutex
+	plugins map[string]Plugin
+	active  map[string]Plugin // initialized plugins
+	cfg     *Config           // the configuration of the active plugins
+}
+
+// NewRegistry constructs a new, empty plugin registry.
+func NewRegistry() *Registry { return new(Registry) }
+
+// Register registers a plugin with r. This method will panic if the same name
 // is registered multiple times.
-func RegisterPlugin(name string, p Plugin) {
-	if old, ok := plugins[name]; ok {
+func (r *Registry) Register(name string, p Plugin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.plugins[name]; ok {
 		log.Panicf("Duplicate registration for plugin %q: %v, %v", name, old, p)
 	} else if p == nil {
 		log.Panicf("Invalid nil plugin for %q", name)
 	}
-	plugins[name] = p
+	if r.plugins == nil {
+		r.plugins = make(map[string]Plugin)
+	}
+	r.plugins[name] = p
 }
 
-// PluginAssigner returns a jrpc2.Assigner that exports the methods of all the
-// registered plugins.
-func PluginAssigner(cfg *Config) jrpc2.Assigner {
+// Init initializes the registered plugins with cfg, and returns a service map
+// that exports the methods of each plugin under its registered name. Plugins
+// disabled by cfg, or that report ErrNotApplicable, are skipped. If any other
+// plugin fails, Init shuts down the plugins it has already initialized and
+// reports the error.
+//
+// In addition, Init starts an external plugin for each plugin configuration
+// in cfg that specifies a command.
+func (r *Registry) Init(cfg *Config) (handler.ServiceMap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	svc := make(handler.ServiceMap)
+	active := make(map[string]Plugin)
+	plugins := maps.Clone(r.plugins)
+	for name, pc := range cfg.Plugins {
+		if _, ok := plugins[name]; ok {
+			if pc != nil && pc.Command != "" {
+				return nil, fmt.Errorf("external plugin %q conflicts with a registered plugin", name)
+			}
+		} else if pc != nil && pc.Command != "" {
+			if plugins == nil {
+				plugins = make(map[string]Plugin)
+			}
+			plugins[name] = newExternalPlugin(name)
+		} else {
+			log.Printf("WARNING: Configuration for unknown plugin %q", name)
+		}
+	}
 	for name, plug := range plugins {
-		if err := plug.Init(cfg); err == ErrNotApplicable {
+		if !cfg.PluginEnabled(name) {
+			log.Printf("Skipping disabled plugin %q", name)
+		} else if err := plug.Init(cfg); err == ErrNotApplicable {
 			log.Printf("Skipping inapplicable plugin %q", name)
 		} else if err != nil {
-			log.Panicf("Initializing plugin %q: %v", name, err)
+			ctx, cancel := context.WithTimeout(context.Background(), initShutdownTimeout)
+			shutdownPlugins(ctx, active)
+			cancel()
+			return nil, fmt.Errorf("initializing plugin %q: %w", name, err)
 		} else {
 			svc[name] = plug.Assigner()
+			active[name] = plug
 		}
 	}
+	r.active, r.cfg = active, cfg
+	return svc, nil
+}
 
-	// Set up a signal handler for SIGHUP, which causes the plugins to be
-	// updated.
+// Update calls the Update method of each initialized plugin that implements
+// Updater concurrently with cfg, and waits for them to finish. If any plugin
+// fails, the plugins that were updated are updated again with the previous
+// configuration, so that either all the plugins use cfg or none do. The
+// resulting error, if any, reports each plugin that failed. Plugins skipped
+// by Init are not updated, and a change to whether a plugin is enabled takes
+// effect only when Init is called again.
+func (r *Registry) Update(cfg *Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updated, errs := r.updateLocked(cfg, r.active)
+	if len(errs) == 0 {
+		r.cfg = cfg
+		return nil
+	}
+	if r.cfg != nil {
+		_, rerrs := r.updateLocked(r.cfg, updated)
+		for _, err := range rerrs {
+			errs = append(errs, fmt.Errorf("rolling back: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateLocked updates the plugins that implement Updater among plugins with
+// cfg concurrently, and reports the plugins that succeeded and the errors from
+// those that failed. The caller must hold r.mu.
+func (r *Registry) updateLocked(cfg *Config, plugins map[string]Plugin) (map[string]Plugin, []error) {
+	updated := make(map[string]Plugin)
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, plug := range plugins {
+		up, ok := plug.(Updater)
+		if !ok {
+			continue
+		}
+		wg.Go(func() {
+			err := up.Update(cfg)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("updating plugin %q: %w", name, err))
+			} else {
+				updated[name] = plug
+			}
+		})
+	}
+	wg.Wait()
+	return updated, errs
+}
+
+// Shutdown calls the Shutdown method of each initialized plugin that
+// implements Shutdowner, and releases the initialized plugins of r. After
+// Shutdown, the plugins must be initialized again before they are used.  The
+// resulting error, if any, reports each plugin that failed.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := shutdownPlugins(ctx, r.active)
+	r.active, r.cfg = nil, nil
+	return err
+}
+
+// shutdownPlugins calls the Shutdown method of each of plugins that
+// implements Shutdowner, and reports each plugin that failed.
+func shutdownPlugins(ctx context.Context, plugins map[string]Plugin) error {
+	var errs []error
+	for name, plug := range plugins {
+		if sd, ok := plug.(Shutdowner); ok {
+			if err := sd.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("shutting down plugin %q: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// defaultRegistry is the registry used by RegisterPlugin and PluginAssigner.
+var defaultRegistry = NewRegistry()
+
+var setup sync.Once
+
+// RegisterPlugin registers a plugin with the default registry. This function
+// will panic if the same name is registered multiple times.
+func RegisterPlugin(name string, p Plugin) { defaultRegistry.Register(name, p) }
+
+// PluginAssigner returns a jrpc2.Assigner that exports the methods of all the
+// plugins in the default registry. It panics if a plugin fails to initialize.
+//
+// The first call to PluginAssigner installs a handler for SIGHUP, which causes
+// the plugins in the default registry to be updated with cfg.
+func PluginAssigner(cfg *Config) jrpc2.Assigner {
+	svc, err := defaultRegistry.Init(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
 	setup.Do(func() {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, syscall.SIGHUP)
 		go func() {
 			for range ch {
-				for name, plug := range plugins {
-					go func() {
-						if err := plug.Update(); err != nil {
-							log.Printf("ERROR updating plugin %q: %v", name, err)
-						}
-					}()
+				if err := defaultRegistry.Update(cfg); err != nil {
+					log.Printf("ERROR: %v", err)
 				}
 			}
 		}()
@@ -86,36 +240,17 @@ func PluginAssigner(cfg *Config) jrpc2.Assigner {
 	return svc
 }
 
-// PromptForText requests a string of text from the user.
+// PromptForText requests a string of text from the user, using the macOS
+// dialog backend. Use the Dialog method of Config to select a different one.
 func PromptForText(ctx context.Context, req *TextRequest) (string, error) {
 	if req.Prompt == "" {
 		return "", jrpc2.Errorf(jrpc2.InvalidParams, "missing prompt string")
 	}
-
-	// Ask osascript to send error text to stdout to simplify error plumbing.
-	cmd := exec.CommandContext(ctx, "osascript", "-s", "ho")
-	cmd.Stdin = strings.NewReader(fmt.Sprintf(`display dialog %q default answer %q hidden answer %v`,
-		req.Prompt, req.Default, req.Hide))
-	raw, err := cmd.Output()
-	out := strings.TrimRight(string(raw), "\n")
-	if err != nil {
-		if strings.Contains(out, "User canceled") {
-			return "", jrpc2.Errorf(UserCancelled, "user cancelled request")
-		}
-		return "", err
-	}
-
-	// Parse the result out of the text delivered to stdout.
-	const needle = "text returned:"
-	if _, after, ok := strings.Cut(out, needle); ok {
-		return after, nil
-	}
-	return "", jrpc2.Errorf(jrpc2.InternalError, "missing user input")
+	return osaDialog{}.PromptText(ctx, req)
 }
 
-// SetSystemClipboard sets the contents of the system clipboard to data.
+// SetSystemClipboard sets the contents of the macOS system clipboard to data.
+// Use the Clipboard method of Config to select a different backend.
 func SetSystemClipboard(ctx context.Context, data []byte) error {
-	cmd := exec.CommandContext(ctx, "pbcopy", "-pboard", "general")
-	cmd.Stdin = bytes.NewReader(data)
-	return cmd.Run()
+	return PasteboardClipboard.SetClipboard(ctx, data)
 }
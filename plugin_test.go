@@ -0,0 +1,77 @@
+package notifier_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/creachadair/jrpc2/handler"
+	"github.com/creachadair/notifier"
+)
+
+// voicePlugin is a plugin that records the voice setting of its current
+// configuration, and fails to update to a configuration whose voice is fail.
+type voicePlugin struct {
+	fail string
+
+	mu    sync.Mutex
+	voice string
+}
+
+func (p *voicePlugin) Init(cfg *notifier.Config) error { return p.Update(cfg) }
+
+func (p *voicePlugin) Assigner() handler.Map { return handler.Map{} }
+
+func (p *voicePlugin) Update(cfg *notifier.Config) error {
+	if p.fail != "" && cfg.Notify.Voice == p.fail {
+		return errors.New("update failed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.voice = cfg.Notify.Voice
+	return nil
+}
+
+func (p *voicePlugin) current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.voice
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	reg := notifier.NewRegistry()
+	a, b := new(voicePlugin), new(voicePlugin)
+	bad := &voicePlugin{fail: "bad"}
+	reg.Register("A", a)
+	reg.Register("B", b)
+	reg.Register("Bad", bad)
+
+	config := func(voice string) *notifier.Config {
+		cfg := new(notifier.Config)
+		cfg.Notify.Voice = voice
+		return cfg
+	}
+	check := func(want string) {
+		t.Helper()
+		for name, p := range map[string]*voicePlugin{"A": a, "B": b, "Bad": bad} {
+			if got := p.current(); got != want {
+				t.Errorf("Plugin %s: got voice %q, want %q", name, got, want)
+			}
+		}
+	}
+	if _, err := reg.Init(config("one")); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	check("one")
+
+	if err := reg.Update(config("two")); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	check("two")
+
+	// When one plugin fails, the others are returned to the previous settings.
+	if err := reg.Update(config("bad")); err == nil {
+		t.Fatal("Update: got nil error, want an error")
+	}
+	check("two")
+}
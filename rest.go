@@ -0,0 +1,201 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/server"
+)
+
+// restMaxBody is the largest request body accepted by a REST endpoint.
+const restMaxBody = 16 << 20
+
+// restRoutes adds the REST endpoints for ep to mux. Each endpoint is a facade
+// for a method of the Notify or Clip service, and is subject to the same
+// authentication and access rules as a JSON-RPC call of that method:
+//
+//	POST /notify       Notify.Post: body is the message; query parameters
+//	                   title, subtitle, audible, and after
+//	POST /say          Notify.Say: body is the text; query parameters voice
+//	                   and after
+//	GET /clip/{tag}    Clip.Get: returns the contents of the clip
+//	PUT /clip/{tag}    Clip.Set: body is the contents of the clip
+//	DELETE /clip/{tag} Clip.Clear
+//	GET /clips         Clip.List: returns a JSON array of tags
+func (s *Server) restRoutes(mux *http.ServeMux, ep *endpoint) {
+	s.restRoute(mux, ep, "POST /notify", "Notify.Post", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		req := &PostRequest{Title: q.Get("title"), Subtitle: q.Get("subtitle"), Body: string(body)}
+		if !parseQuery(w, q.Get("audible"), strconv.ParseBool, &req.Audible) ||
+			!parseQuery(w, q.Get("after"), time.ParseDuration, &req.After) {
+			return
+		}
+		if call(req, nil) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s.restRoute(mux, ep, "POST /say", "Notify.Say", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		req := &SayRequest{Text: string(body), Voice: q.Get("voice")}
+		if !parseQuery(w, q.Get("after"), time.ParseDuration, &req.After) {
+			return
+		}
+		if call(req, nil) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s.restRoute(mux, ep, "GET /clip/{tag}", "Clip.Get", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		var data []byte
+		if call(&ClipGetRequest{Tag: r.PathValue("tag")}, &data) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(data)
+		}
+	})
+	s.restRoute(mux, ep, "PUT /clip/{tag}", "Clip.Set", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		if call(&ClipSetRequest{Data: body, Tag: r.PathValue("tag")}, nil) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s.restRoute(mux, ep, "DELETE /clip/{tag}", "Clip.Clear", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		tag := r.PathValue("tag")
+		var found bool
+		if !call(&ClipClearRequest{Tag: tag}, &found) {
+			return
+		} else if !found {
+			http.Error(w, fmt.Sprintf("tag %q not found", tag), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.restRoute(mux, ep, "GET /clips", "Clip.List", func(w http.ResponseWriter, r *http.Request, call restCaller) {
+		var tags []string
+		if call(nil, &tags) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tags)
+		}
+	})
+}
+
+// A restCaller calls the method of a REST endpoint with params, and decodes
+// its result into result unless result == nil. If the call fails, it writes an
+// error response and returns false.
+type restCaller func(params, result any) bool
+
+// restRoute adds a handler to mux for the REST endpoint pattern of ep, which
+// calls method. The client of a request is identified and its access to method
+// is checked before serve is called, so that the body of a request that will
+// be refused is not read.
+func (s *Server) restRoute(mux *http.ServeMux, ep *endpoint, pattern, method string, serve func(http.ResponseWriter, *http.Request, restCaller)) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := s.httpSession(w, r, ep)
+		if !ok {
+			return
+		} else if err := (dispatcher{s: s, sess: sess}).permit(method); err != nil {
+			restError(w, err)
+			return
+		}
+		serve(w, r, func(params, result any) bool {
+			return s.restCall(w, r, sess, method, params, result)
+		})
+	})
+}
+
+// restCall calls method with params for the client of sess, and decodes its
+// result into result unless result == nil. If the call fails, restCall writes
+// an error response to w and returns false.
+func (s *Server) restCall(w http.ResponseWriter, r *http.Request, sess *session, method string, params, result any) bool {
+	loc := server.NewLocal(dispatcher{s: s, sess: sess}, &server.LocalOptions{
+		Server: s.serverOptions(r.Context(), sess),
+	})
+	defer loc.Close()
+
+	rsp, err := loc.Client.Call(r.Context(), method, params)
+	if err == nil && result != nil {
+		err = rsp.UnmarshalResult(result)
+	}
+	if err != nil {
+		restError(w, err)
+		return false
+	}
+	return true
+}
+
+// restError writes an error response for err to w.
+func restError(w http.ResponseWriter, err error) {
+	msg := err.Error()
+	var jerr *jrpc2.Error
+	if errors.As(err, &jerr) {
+		msg = jerr.Message
+	}
+	code := jrpc2.ErrorCode(err)
+	if code == Unauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, msg, httpStatus(code))
+}
+
+// httpStatus returns the HTTP status corresponding to an error code.
+func httpStatus(code jrpc2.Code) int {
+	switch code {
+	case jrpc2.InvalidParams, jrpc2.InvalidRequest:
+		return http.StatusBadRequest
+	case ResourceNotFound, jrpc2.MethodNotFound:
+		return http.StatusNotFound
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case UserCancelled:
+		return http.StatusConflict
+	case jrpc2.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case jrpc2.Cancelled:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readBody reads the body of r. If the body cannot be read, readBody writes
+// an error response to w and returns false.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, restMaxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// parseQuery parses s into *v using parse, unless s is empty. If s is invalid,
+// parseQuery writes an error response to w and returns false.
+func parseQuery[T any](w http.ResponseWriter, s string, parse func(string) (T, error), v *T) bool {
+	if s == "" {
+		return true
+	}
+	z, err := parse(s)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid query value %q", s), http.StatusBadRequest)
+		return false
+	}
+	*v = z
+	return true
+}
@@ -0,0 +1,131 @@
+package notifier_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/notifier"
+	"github.com/creachadair/notifier/notifiertest"
+)
+
+func newHTTPServer(t *testing.T) *notifiertest.NetServer {
+	t.Helper()
+	return newServer(t, &notifier.Config{
+		HTTP: &notifier.HTTPConfig{
+			AllowOrigins: []string{"chrome-extension://ok"},
+			AllowHosts:   []string{"notes.example"},
+		},
+		Auth: notifier.AuthConfig{Tokens: map[string]string{
+			"alice": "alice-secret",
+			"bob":   "bob-secret",
+		}},
+		ACL: map[string][]string{
+			"token:alice": {"*"},
+			"token:bob":   {"Clip.Get", "Clip.List"},
+		},
+	})
+}
+
+func TestREST(t *testing.T) {
+	s := newHTTPServer(t)
+	base := "http://" + s.Addr
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		origin string
+		body   string
+		want   int
+		output string
+	}{
+		{"NoToken", "GET", "/clips", "", "", "", http.StatusUnauthorized, ""},
+		{"BadToken", "GET", "/clips", "bogus", "", "", http.StatusUnauthorized, ""},
+		{"BadOrigin", "GET", "/clips", "alice-secret", "https://evil.example", "", http.StatusForbidden, ""},
+
+		// Access is checked before the request is parsed.
+		{"NoTokenBadQuery", "POST", "/notify?after=bogus", "", "", "hi", http.StatusUnauthorized, ""},
+		{"ForbiddenBadQuery", "POST", "/notify?after=bogus", "bob-secret", "", "hi", http.StatusForbidden, ""},
+		{"BadQuery", "POST", "/notify?after=bogus", "alice-secret", "", "hi", http.StatusBadRequest, ""},
+
+		{"Notify", "POST", "/notify?title=T", "alice-secret", "chrome-extension://ok", "hello", http.StatusNoContent, ""},
+		{"SetClip", "PUT", "/clip/x", "alice-secret", "", "stuff", http.StatusNoContent, ""},
+		{"SetClipForbidden", "PUT", "/clip/x", "bob-secret", "", "other", http.StatusForbidden, ""},
+		{"GetClip", "GET", "/clip/x", "bob-secret", "", "", http.StatusOK, "stuff"},
+		{"GetMissing", "GET", "/clip/nonesuch", "bob-secret", "", "", http.StatusNotFound, ""},
+		{"ListClips", "GET", "/clips", "bob-secret", "", "", http.StatusOK, `["active","x"]` + "\n"},
+		{"ClearClip", "DELETE", "/clip/x", "alice-secret", "", "", http.StatusNoContent, ""},
+		{"ClearMissing", "DELETE", "/clip/x", "alice-secret", "", "", http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, base+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+			}
+			defer rsp.Body.Close()
+			body, _ := io.ReadAll(rsp.Body)
+			if rsp.StatusCode != tc.want {
+				t.Errorf("%s %s: got status %d, want %d (body %q)", tc.method, tc.path, rsp.StatusCode, tc.want, body)
+			} else if tc.output != "" && string(body) != tc.output {
+				t.Errorf("%s %s: got body %q, want %q", tc.method, tc.path, body, tc.output)
+			}
+		})
+	}
+
+	if got := s.Poster.Posted(); len(got) != 1 || got[0].Title != "T" || got[0].Body != "hello" {
+		t.Errorf("Posted: got %+v, want one notification with title T", got)
+	}
+	if got := string(s.Clipboard.Contents()); got != "stuff" {
+		t.Errorf("Clipboard: got %q, want %q", got, "stuff")
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	s := newHTTPServer(t)
+	_, port, _ := net.SplitHostPort(s.Addr)
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{s.Addr, http.StatusOK},
+		{"localhost:" + port, http.StatusOK},
+		{"LocalHost", http.StatusOK},
+		{"[::1]:" + port, http.StatusOK},
+		{"notes.example:" + port, http.StatusOK},
+		{"evil.example:" + port, http.StatusForbidden},
+		{"evil.example", http.StatusForbidden},
+		{"10.0.0.1:" + port, http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		req, err := http.NewRequest("GET", "http://"+s.Addr+"/clips", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Host = tc.host
+		req.Header.Set("Authorization", "Bearer alice-secret")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET with host %q: %v", tc.host, err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tc.want {
+			t.Errorf("GET with host %q: got status %d, want %d", tc.host, rsp.StatusCode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,820 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/jrpc2/handler"
+)
+
+var processID = new(expvar.Int)
+
+// ErrServerClosed is reported by the Serve method of a Server after the server
+// has been shut down.
+var ErrServerClosed = errors.New("server closed")
+
+// ServerOptions are optional settings for a Server. A nil *ServerOptions is
+// ready for use and provides default values as described.
+type ServerOptions struct {
+	// Accept connections from these listeners. If empty, the server listens
+	// on the address given by the configuration.
+	Listeners []net.Listener
+
+	// If not nil, send debug logs here.
+	Logger jrpc2.Logger
+
+	// Serve the plugins in this registry. If nil, the plugins registered by
+	// RegisterPlugin are served.
+	Registry *Registry
+
+	// If true, the server does not listen for connections, and Listeners is
+	// ignored. Use ServeChannel to serve sessions.
+	NoListen bool
+}
+
+// A Server serves the methods of a registry of plugins to clients connected
+// over one or more listeners.
+type Server struct {
+	cfg     *Config
+	reg     *Registry
+	log     jrpc2.Logger
+	svc     handler.ServiceMap
+	start   time.Time
+	hopName string // the name of s in forwarding hops, unless configured
+
+	reload sync.Mutex // serializes calls to Reload
+
+	mu      sync.Mutex
+	eps     []*endpoint
+	dials   []*endpoint   // remote endpoints dialed by s
+	local   *endpoint     // the endpoint of sessions served by ServeChannel
+	up      *upstream     // where calls are forwarded, or nil
+	stop    chan struct{} // closed when s is closed
+	conns   map[*jrpc2.Server]*session
+	closed  bool
+	serving sync.WaitGroup // active connections
+	calls   sync.WaitGroup // calls in progress
+}
+
+// NewServer constructs a server for the plugins specified by opts, initialized
+// with cfg. Unless opts provides listeners, NewServer listens on cfg.Address
+// and the addresses in cfg.Listen, using the settings for each address.
+//
+// If the process was started by systemd socket activation, NewServer uses the
+// inherited listeners instead of listening itself. An inherited listener is
+// used for a configured address if its name (FileDescriptorName) is the
+// address, or if it is listening on that address. Inherited listeners that do
+// not match a configured address use the top-level settings.
+// The server does not accept connections until its Serve method is called.
+func NewServer(cfg *Config, opts *ServerOptions) (*Server, error) {
+	if opts == nil {
+		opts = new(ServerOptions)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	reg := opts.Registry
+	if reg == nil {
+		reg = defaultRegistry
+	}
+	var eps []*endpoint
+	switch {
+	case opts.NoListen:
+		// Sessions are provided by the caller.
+	case len(opts.Listeners) != 0:
+		pol, err := newPolicy(cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, ln := range opts.Listeners {
+			eps = append(eps, &endpoint{ln: ln, http: cfg.HTTP != nil, pol: pol})
+		}
+	default:
+		inh, err := activationListeners()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: %w", err)
+		}
+		eps, err = configEndpoints(cfg, inh)
+		if err != nil {
+			return nil, err
+		} else if len(eps) == 0 && len(cfg.Dial) == 0 {
+			return nil, errors.New("no server address is defined")
+		}
+	}
+	dials, err := dialEndpoints(cfg)
+	if err != nil {
+		closeEndpoints(eps)
+		return nil, err
+	}
+	local, err := newPolicy(cfg)
+	if err != nil {
+		closeEndpoints(eps)
+		return nil, err
+	}
+	svc, err := reg.Init(cfg)
+	if err != nil {
+		closeEndpoints(eps)
+		return nil, err
+	} else if _, ok := svc[sessionService]; ok {
+		closeEndpoints(eps)
+		return nil, fmt.Errorf("plugin name %q is reserved", sessionService)
+	}
+
+	processID.Set(int64(os.Getpid()))
+	jrpc2.ServerMetrics().Set("noteserver_pid", processID)
+
+	return &Server{
+		cfg:     cfg,
+		reg:     reg,
+		log:     opts.Logger,
+		svc:     svc,
+		start:   time.Now().In(time.UTC),
+		hopName: defaultName(),
+
+		eps:   eps,
+		dials: dials,
+		local: &endpoint{pol: local},
+		up:    newUpstream(cfg),
+		stop:  make(chan struct{}),
+		conns: make(map[*jrpc2.Server]*session),
+	}, nil
+}
+
+// An endpoint is a listener, or a remote endpoint dialed by the server, and
+// the settings that apply to its connections.
+type endpoint struct {
+	addr string // the configured address, or "" if provided by the caller
+	ln   net.Listener
+	http bool        // serve HTTP rather than line-delimited JSON-RPC
+	dial *DialConfig // the settings of a dialed endpoint, which has no listener
+
+	// These fields are protected by the mutex of the Server.
+	pol *policy
+	hs  *http.Server // set while serving HTTP
+}
+
+// configEndpoints returns an endpoint for each address defined by cfg, using
+// the matching inherited listener if there is one, plus an endpoint for each
+// inherited listener that does not match an address.
+func configEndpoints(cfg *Config, inh []*inheritedListener) ([]*endpoint, error) {
+	var eps []*endpoint
+	fail := func(err error) ([]*endpoint, error) {
+		closeEndpoints(eps)
+		for _, il := range inh {
+			il.ln.Close()
+		}
+		return nil, err
+	}
+	for _, lc := range cfg.listenConfigs() {
+		var ln net.Listener
+		if i := slices.IndexFunc(inh, func(il *inheritedListener) bool {
+			return il.matches(lc.Address)
+		}); i >= 0 {
+			ln = inh[i].ln
+			inh = slices.Delete(inh, i, i+1)
+		}
+		ep, err := listenEndpoint(lc, ln)
+		if err != nil {
+			return fail(fmt.Errorf("listen %q: %w", lc.Address, err))
+		}
+		eps = append(eps, ep)
+	}
+	if len(inh) != 0 {
+		pol, err := newPolicy(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		for _, il := range inh {
+			eps = append(eps, &endpoint{ln: il.ln, http: cfg.HTTP != nil, pol: pol})
+		}
+	}
+	return eps, nil
+}
+
+// listenEndpoint returns an endpoint for cfg.Address using the listener
+// settings of cfg. If ln != nil, it is used instead of listening on the
+// address, and the socket settings are not applied. In case of error, ln is
+// closed.
+func listenEndpoint(cfg *Config, ln net.Listener) (*endpoint, error) {
+	fail := func(err error) (*endpoint, error) {
+		if ln != nil {
+			ln.Close()
+		}
+		return nil, err
+	}
+	pol, err := newPolicy(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	tc, err := cfg.ServerTLS()
+	if err != nil {
+		return fail(fmt.Errorf("loading TLS settings: %w", err))
+	}
+	if ln == nil {
+		var mode os.FileMode
+		ln, mode, err = listen(cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		if path, ok := socketPath(ln); ok {
+			if err := cfg.setupSocket(path, mode); err != nil {
+				return fail(fmt.Errorf("setting up socket: %w", err))
+			}
+		}
+	}
+	if tc != nil {
+		ln = tls.NewListener(ln, tc)
+	}
+	return &endpoint{addr: cfg.Address, ln: ln, http: cfg.HTTP != nil, pol: pol}, nil
+}
+
+// A policy is the settings that determine which clients may connect to an
+// endpoint, and which methods they may call.
+type policy struct {
+	tokens     map[string]string   // token → name
+	acl        map[string][]string // identity → method globs
+	uids       []int               // allowed Unix peer uids
+	origins    []string            // allowed HTTP origins
+	hosts      []string            // allowed HTTP hosts, besides loopback
+	downstream []string            // identities that may forward calls
+	removed    bool                // the listener was removed from the configuration
+}
+
+func newPolicy(cfg *Config) (*policy, error) {
+	tokens, err := cfg.AuthTokens()
+	if err != nil {
+		return nil, fmt.Errorf("loading tokens: %w", err)
+	}
+	pol := &policy{
+		tokens:     tokens,
+		acl:        cfg.ACL,
+		uids:       cfg.Socket.AllowUIDs,
+		downstream: cfg.Downstream,
+	}
+	if cfg.HTTP != nil {
+		pol.origins = cfg.HTTP.AllowOrigins
+		pol.hosts = cfg.HTTP.AllowHosts
+	}
+	return pol, nil
+}
+
+// dialEndpoints returns an endpoint for each remote endpoint defined by cfg.
+func dialEndpoints(cfg *Config) ([]*endpoint, error) {
+	var eps []*endpoint
+	for _, dc := range cfg.Dial {
+		pol, err := newPolicy(dc.settings())
+		if err != nil {
+			return nil, fmt.Errorf("dial %q: %w", dc.Address, err)
+		}
+		eps = append(eps, &endpoint{addr: dc.Address, dial: dc, pol: pol})
+	}
+	return eps, nil
+}
+
+// Listen listens for connections at addr. An address of the form host:port is
+// TCP, otherwise it is the path of a Unix-domain socket. Environment variables
+// in a socket path are expanded. While the listener is open, a lock file is
+// held next to the socket. A stale socket left behind by a previous run is
+// removed, but Listen reports an error if another server is using the socket.
+// A socket path beginning with "@" names an abstract socket, which has no
+// file and no lock.
+//
+// A socket is created accessible only to the current user, and then given the
+// permissions allowed by the process umask.
+func Listen(addr string) (net.Listener, error) {
+	ln, mode, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if path, ok := socketPath(ln); ok {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// ListenPrivate is like Listen, but a socket is left accessible only to the
+// current user. An abstract socket cannot be made private, and is accessible
+// to any process in the same network namespace.
+func ListenPrivate(addr string) (net.Listener, error) {
+	ln, _, err := listen(addr)
+	return ln, err
+}
+
+// listen listens for connections at addr as described by Listen, but leaves a
+// socket accessible only to the current user. It also returns the mode the
+// socket would otherwise have had under the process umask.
+func listen(addr string) (net.Listener, os.FileMode, error) {
+	atype, addr := jrpc2.Network(addr)
+	if atype == "unix" {
+		return listenUnix(os.ExpandEnv(addr))
+	}
+	ln, err := net.Listen(atype, addr)
+	return ln, 0, err
+}
+
+// socketPath returns the path of the socket file of ln, and reports whether
+// ln is listening on a Unix-domain socket that has one.
+func socketPath(ln net.Listener) (string, bool) {
+	ua, ok := ln.Addr().(*net.UnixAddr)
+	if !ok || ua.Name == "" || ua.Name[0] == '@' {
+		return "", false
+	}
+	return ua.Name, true
+}
+
+// Serve accepts and serves connections on the listeners of s, and on the
+// connections it dials, until s is shut down or ctx ends. When ctx ends,
+// active connections are stopped immediately.
+// Serve always reports a non-nil error; after Shutdown, it is ErrServerClosed.
+func (s *Server) Serve(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	eps := s.eps
+	s.serving.Add(len(s.dials))
+	for _, ep := range s.dials {
+		go s.dialLoop(ctx, ep)
+	}
+	s.mu.Unlock()
+
+	errc := make(chan error, len(eps))
+	for _, ep := range eps {
+		serve := s.accept
+		if ep.http {
+			serve = s.serveHTTP
+		}
+		go func() {
+			// A listener closed by Reload is not an error.
+			if err := serve(ctx, ep); !s.policy(ep).removed {
+				errc <- err
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.closeListeners()
+		s.stopConns()
+	case <-s.stop:
+		err = ErrServerClosed
+	case err = <-errc:
+		if s.isClosed() {
+			// Shutdown will stop the connections once they are drained.
+			err = ErrServerClosed
+		} else {
+			s.closeListeners()
+			s.stopConns()
+		}
+	}
+	s.serving.Wait()
+	return err
+}
+
+// accept accepts connections from ep and starts a server for each, until its
+// listener reports an error.
+func (s *Server) accept(ctx context.Context, ep *endpoint) error {
+	for {
+		conn, err := ep.ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handshake(ctx, conn, ep)
+	}
+}
+
+// handshake identifies the client of conn and starts a server for it if it
+// is permitted to connect.
+func (s *Server) handshake(ctx context.Context, conn net.Conn, ep *endpoint) {
+	peer, err := s.identify(conn, ep)
+	if err != nil {
+		log.Printf("Rejected connection from %s: %v", peer, err)
+		conn.Close()
+		return
+	}
+	s.log.Printf("Accepted connection from %s", peer)
+	s.serveConn(ctx, channel.Line(conn, conn), &session{peer: peer, ep: ep})
+}
+
+// identify returns a description of the client of conn, completing the TLS
+// handshake if conn uses TLS. It reports an error if the client is not
+// permitted to connect to ep.
+func (s *Server) identify(conn net.Conn, ep *endpoint) (Peer, error) {
+	addr := conn.RemoteAddr()
+	peer := Peer{Network: addr.Network(), Address: addr.String()}
+	raw := conn
+	if tc, ok := conn.(*tls.Conn); ok {
+		raw = tc.NetConn()
+	}
+	cred, err := unixPeerCred(raw)
+	if err != nil {
+		log.Printf("Reading credentials for %s failed: %v", peer, err)
+	}
+	peer.Cred = cred
+
+	if _, ok := raw.(*net.UnixConn); ok && !uidAllowed(s.policy(ep).uids, cred) {
+		return peer, errors.New("user not allowed")
+	}
+	peer.TLSSubject, err = tlsSubject(conn)
+	if err != nil {
+		return peer, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return peer, nil
+}
+
+// ServeChannel serves a single session on ch, for the client described by
+// peer, until the client closes the channel, s is shut down, or ctx ends.  The
+// session uses the top-level settings of the configuration for authentication
+// and access control, and changes to them by Reload apply to the session.
+func (s *Server) ServeChannel(ctx context.Context, ch channel.Channel, peer Peer) error {
+	sess := &session{peer: peer, ep: s.local}
+	srv := s.serveConn(ctx, ch, sess)
+	if srv == nil {
+		return ErrServerClosed
+	}
+	defer context.AfterFunc(ctx, func() { sess.ch.Close() })()
+	return srv.Wait()
+}
+
+// serveConn starts a server on ch for the session sess, and tracks it until it
+// exits. It returns the server, or nil if s has been shut down or the endpoint
+// of sess has been removed.
+func (s *Server) serveConn(ctx context.Context, ch channel.Channel, sess *session) *jrpc2.Server {
+	srv := jrpc2.NewServer(dispatcher{s: s, sess: sess}, s.serverOptions(ctx, sess))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || sess.ep.pol.removed {
+		ch.Close()
+		return nil
+	}
+	sess.ch = &closeOnce{Channel: ch}
+	s.conns[srv] = sess
+	s.serving.Add(1)
+	srv.Start(sess.ch)
+	go func() {
+		defer s.serving.Done()
+		if err := srv.Wait(); err != nil {
+			s.log.Printf("Server exit: %v", err)
+		}
+		s.mu.Lock()
+		delete(s.conns, srv)
+		s.mu.Unlock()
+	}()
+	return srv
+}
+
+// closeOnce wraps a channel so that it is closed only once, since both the
+// server of a session and s may close it.
+type closeOnce struct {
+	channel.Channel
+	once sync.Once
+	err  error
+}
+
+func (c *closeOnce) Close() error {
+	c.once.Do(func() { c.err = c.Channel.Close() })
+	return c.err
+}
+
+// serverOptions returns the options for a server for sess, whose handlers run
+// in contexts derived from ctx.
+func (s *Server) serverOptions(ctx context.Context, sess *session) *jrpc2.ServerOptions {
+	sctx := context.WithValue(ctx, sessionKey{}, sess)
+	return &jrpc2.ServerOptions{
+		Logger:     s.log,
+		StartTime:  s.start,
+		NewContext: func() context.Context { return sctx },
+	}
+}
+
+// A dispatcher is the jrpc2.Assigner for a single connection to a server.  It
+// implements the Session service, rejects calls from a client that has not
+// authenticated when authentication is required or that the access control
+// rules do not permit, forwards calls to the services of the upstream server,
+// and tracks calls in progress so that Shutdown can wait for them. Calls that
+// arrive after shutdown has begun are rejected.
+type dispatcher struct {
+	s    *Server
+	sess *session
+}
+
+func (d dispatcher) Assign(ctx context.Context, method string) jrpc2.Handler {
+	h := d.handler(ctx, method)
+	if h == nil {
+		return nil
+	}
+	return func(ctx context.Context, req *jrpc2.Request) (any, error) {
+		if !d.s.beginCall() {
+			return nil, jrpc2.Errorf(jrpc2.SystemError, "server is shutting down")
+		}
+		defer d.s.calls.Done()
+		return h(ctx, req)
+	}
+}
+
+// handler returns the handler for calls to method by the client of d, or nil
+// if there is no such method. It does not track calls in progress.
+func (d dispatcher) handler(ctx context.Context, method string) jrpc2.Handler {
+	if svc, name, ok := strings.Cut(method, "."); ok && svc == sessionService {
+		return d.sessionMethods()[name]
+	} else if err := d.permit(method); err != nil {
+		return func(context.Context, *jrpc2.Request) (any, error) { return nil, err }
+	} else if up := d.s.upstream(method); up != nil {
+		return d.forward(up, method)
+	}
+	return d.s.svc.Assign(ctx, method)
+}
+
+func (d dispatcher) Names() []string {
+	names := d.s.svc.Names()
+	for name := range d.sessionMethods() {
+		names = append(names, sessionService+"."+name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sessionMethods returns the methods of the Session service.
+func (d dispatcher) sessionMethods() handler.Map {
+	return handler.Map{
+		"Auth":    handler.New(d.auth),
+		"Forward": handler.New(d.forwarded),
+	}
+}
+
+// auth implements the Session.Auth method.
+func (d dispatcher) auth(ctx context.Context, req *AuthRequest) (bool, error) {
+	name, ok := checkToken(d.s.policy(d.sess.ep).tokens, req.Token)
+	if !ok {
+		return false, jrpc2.Errorf(Unauthorized, "invalid token")
+	}
+	d.sess.mu.Lock()
+	d.sess.peer.Token = name
+	d.sess.token = req.Token
+	d.sess.mu.Unlock()
+	d.s.log.Printf("Client %s authenticated", d.sess.Peer())
+	return true, nil
+}
+
+// permit reports an error if the client of d is not permitted to call method,
+// which is not a method of the Session service.
+func (d dispatcher) permit(method string) error {
+	if !d.authorized() {
+		return errUnauthorized
+	} else if p := d.sess.Peer(); !aclAllows(d.s.policy(d.sess.ep).acl, p, method) {
+		log.Printf("Client %s denied access to %q", p, method)
+		return jrpc2.Errorf(Forbidden, "access to %q is not permitted", method)
+	}
+	return nil
+}
+
+// authorized reports whether the client of d is permitted to call methods
+// other than those of the Session service. The token the client authenticated
+// with is checked against the current policy on each call, so that a token
+// removed by a reload is no longer accepted.
+func (d dispatcher) authorized() bool {
+	pol := d.s.policy(d.sess.ep)
+	if pol.removed {
+		return false
+	}
+	d.sess.mu.Lock()
+	defer d.sess.mu.Unlock()
+	if d.sess.token != "" {
+		name, ok := checkToken(pol.tokens, d.sess.token)
+		if !ok && d.sess.peer.Token != "" {
+			log.Printf("Token of client %s is no longer valid", d.sess.peer)
+		}
+		d.sess.peer.Token = name
+	}
+	p := d.sess.peer
+	return len(pol.tokens) == 0 || p.Token != "" || p.TLSSubject != ""
+}
+
+// policy returns the current policy for connections to ep.
+func (s *Server) policy(ep *endpoint) *policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ep.pol
+}
+
+// beginCall reports whether s is accepting calls, and if so records the start
+// of a call. The caller must call s.calls.Done when the call is complete.
+func (s *Server) beginCall() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.calls.Add(1)
+	return true
+}
+
+// Reload validates cfg and, if it is valid, delivers it to the plugins served
+// by s. If cfg is invalid, or any plugin fails to apply it, Reload reports an
+// error and the configuration of s and its plugins is not changed. The
+// authentication and access settings of each listener and remote endpoint
+// apply to new calls immediately, and a listener or remote endpoint whose
+// address was removed is closed along with its sessions. Added addresses,
+// including an address added back after it was removed, and changes to the
+// socket and TLS settings, do not take effect until the server is restarted.
+func (s *Server) Reload(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	s.reload.Lock()
+	defer s.reload.Unlock()
+
+	s.mu.Lock()
+	old, eps, dials := s.cfg, s.eps, s.dials
+	s.mu.Unlock()
+	pols := make(map[*endpoint]*policy)
+	for _, ep := range append([]*endpoint{s.local}, eps...) {
+		lc := cfg.listenerConfig(ep.addr)
+		if lc == nil {
+			pols[ep] = &policy{removed: true}
+			continue
+		}
+		pol, err := newPolicy(lc)
+		if err != nil {
+			return err
+		}
+		pols[ep] = pol
+	}
+	for _, ep := range dials {
+		i := slices.IndexFunc(cfg.Dial, func(dc *DialConfig) bool { return dc.Address == ep.addr })
+		if i < 0 {
+			pols[ep] = &policy{removed: true}
+			continue
+		}
+		pol, err := newPolicy(cfg.Dial[i].settings())
+		if err != nil {
+			return err
+		}
+		pols[ep] = pol
+	}
+	for _, dc := range cfg.Dial {
+		if !slices.ContainsFunc(dials, func(ep *endpoint) bool { return ep.addr == dc.Address }) {
+			log.Printf("Remote %q was added; it will be dialed after a restart", dc.Address)
+		}
+	}
+	if err := s.reg.Update(cfg); err != nil {
+		return err
+	}
+	diffs := old.Diff(cfg)
+	if len(diffs) == 0 {
+		log.Printf("Reloaded configuration is unchanged")
+	}
+	for _, diff := range diffs {
+		log.Printf("Config changed: %s", diff)
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	for ep, pol := range pols {
+		ep.pol = pol
+	}
+	removed := func(ep *endpoint) bool { return ep.pol.removed }
+	s.eps = slices.DeleteFunc(slices.Clone(s.eps), removed)
+	s.dials = slices.DeleteFunc(slices.Clone(s.dials), removed)
+	var oldUp *upstream
+	if !reflect.DeepEqual(old.Upstream, cfg.Upstream) {
+		oldUp, s.up = s.up, newUpstream(cfg)
+	}
+	s.mu.Unlock()
+
+	for ep, pol := range pols {
+		if !pol.removed {
+			continue
+		} else if ep.dial != nil {
+			log.Printf("Remote %q was removed; closing its session", ep.addr)
+		} else {
+			log.Printf("Listener %q was removed; closing it and its sessions", ep.addr)
+		}
+		s.closeEndpoint(ep)
+	}
+	if oldUp != nil {
+		oldUp.close()
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down s. It closes the listeners, waits for calls
+// in progress to complete, stops all active connections, and then shuts down
+// the plugins. If ctx ends before the calls in progress have finished, the
+// remaining calls are cancelled and Shutdown reports the error from ctx along
+// with any errors from the plugins.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
+	done := make(chan struct{})
+	go func() { defer close(done); s.calls.Wait() }()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+	}
+	s.stopConns()
+	s.serving.Wait()
+	return errors.Join(err, s.reg.Shutdown(ctx))
+}
+
+// closeListeners closes the listeners of s, and marks it as closed so that no
+// new connections or calls are accepted.
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+		closeEndpoints(s.eps)
+	}
+}
+
+// stopConns stops all the active connections of s.
+func (s *Server) stopConns() {
+	s.mu.Lock()
+	chs := s.channelsLocked(nil)
+	up := s.up
+	var servers []*http.Server
+	for _, ep := range s.eps {
+		if ep.hs != nil {
+			servers = append(servers, ep.hs)
+		}
+	}
+	s.mu.Unlock()
+
+	// The sessions are ended by closing their channels without holding s.mu,
+	// since a session may be waiting for s.mu while dispatching a call.
+	for _, ch := range chs {
+		ch.Close()
+	}
+	if up != nil {
+		up.close()
+	}
+	for _, hs := range servers {
+		hs.Close()
+	}
+}
+
+// channelsLocked returns the channels of the active sessions of clients of
+// ep, or of all clients if ep == nil. The caller must hold s.mu.
+func (s *Server) channelsLocked(ep *endpoint) []channel.Channel {
+	var chs []channel.Channel
+	for _, sess := range s.conns {
+		if ep == nil || sess.ep == ep {
+			chs = append(chs, sess.ch)
+		}
+	}
+	return chs
+}
+
+// closeEndpoint closes the listener of ep, if it has one, and ends the
+// sessions of its clients. The caller must not hold s.mu.
+func (s *Server) closeEndpoint(ep *endpoint) {
+	s.mu.Lock()
+	hs := ep.hs
+	chs := s.channelsLocked(ep)
+	s.mu.Unlock()
+	if hs != nil {
+		hs.Close()
+	}
+	if ep.ln != nil {
+		ep.ln.Close()
+	}
+	for _, ch := range chs {
+		ch.Close()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func closeEndpoints(eps []*endpoint) {
+	for _, ep := range eps {
+		ep.ln.Close()
+	}
+}
@@ -0,0 +1,362 @@
+package notifier_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/notifier"
+	"github.com/creachadair/notifier/notifiertest"
+)
+
+func newServer(t *testing.T, cfg *notifier.Config) *notifiertest.NetServer {
+	t.Helper()
+	s := notifiertest.NewNetServer(cfg)
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Server close: %v", err)
+		}
+	})
+	return s
+}
+
+func dial(t *testing.T, s *notifiertest.NetServer) *jrpc2.Client {
+	t.Helper()
+	cli, err := s.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+// authenticate dials s and authenticates with token.
+func authenticate(t *testing.T, s *notifiertest.NetServer, token string) *jrpc2.Client {
+	t.Helper()
+	cli := dial(t, s)
+	if _, err := cli.Call(context.Background(), "Session.Auth", &notifier.AuthRequest{Token: token}); err != nil {
+		t.Fatalf("Session.Auth: %v", err)
+	}
+	return cli
+}
+
+func checkCode(t *testing.T, err error, want jrpc2.Code) {
+	t.Helper()
+	if got := jrpc2.ErrorCode(err); got != want {
+		t.Errorf("Got error %v (code %v), want code %v", err, got, want)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	cfg := &notifier.Config{Auth: notifier.AuthConfig{
+		Tokens: map[string]string{"alice": "alice-secret"},
+	}}
+	s := newServer(t, cfg)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, err := dial(t, s).Call(ctx, "Clip.List", nil)
+		checkCode(t, err, notifier.Unauthorized)
+	})
+	t.Run("InvalidToken", func(t *testing.T) {
+		cli := dial(t, s)
+		_, err := cli.Call(ctx, "Session.Auth", &notifier.AuthRequest{Token: "bogus"})
+		checkCode(t, err, notifier.Unauthorized)
+		_, err = cli.Call(ctx, "Clip.List", nil)
+		checkCode(t, err, notifier.Unauthorized)
+	})
+	t.Run("ValidToken", func(t *testing.T) {
+		if _, err := authenticate(t, s, "alice-secret").Call(ctx, "Clip.List", nil); err != nil {
+			t.Errorf("Clip.List: unexpected error: %v", err)
+		}
+	})
+	t.Run("Revoked", func(t *testing.T) {
+		cli := authenticate(t, s, "alice-secret")
+		if _, err := cli.Call(ctx, "Clip.List", nil); err != nil {
+			t.Fatalf("Clip.List: unexpected error: %v", err)
+		}
+
+		// Replacing the token revokes it for sessions already authenticated.
+		next := *cfg
+		next.Auth.Tokens = map[string]string{"bob": "bob-secret"}
+		if err := s.Reload(&next); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+		t.Cleanup(func() { s.Reload(cfg) })
+
+		_, err := cli.Call(ctx, "Clip.List", nil)
+		checkCode(t, err, notifier.Unauthorized)
+	})
+}
+
+func TestACL(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, &notifier.Config{
+		Auth: notifier.AuthConfig{Tokens: map[string]string{
+			"alice": "alice-secret",
+			"bob":   "bob-secret",
+		}},
+		ACL: map[string][]string{
+			"*":           {"Notify.Post"},
+			"token:alice": {"Clip.*"},
+		},
+	})
+	alice := authenticate(t, s, "alice-secret")
+	bob := authenticate(t, s, "bob-secret")
+	post := &notifier.PostRequest{Body: "hello"}
+
+	tests := []struct {
+		name   string
+		cli    *jrpc2.Client
+		method string
+		params any
+		want   jrpc2.Code
+	}{
+		{"alice/Clip.List", alice, "Clip.List", nil, jrpc2.NoError},
+		{"alice/Notify.Post", alice, "Notify.Post", post, jrpc2.NoError},
+		{"alice/Notify.Say", alice, "Notify.Say", &notifier.SayRequest{Text: "hi"}, notifier.Forbidden},
+		{"bob/Notify.Post", bob, "Notify.Post", post, jrpc2.NoError},
+		{"bob/Clip.List", bob, "Clip.List", nil, notifier.Forbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.cli.Call(ctx, tc.method, tc.params)
+			checkCode(t, err, tc.want)
+		})
+	}
+	if got := len(s.Poster.Posted()); got != 2 {
+		t.Errorf("Got %d notifications, want 2", got)
+	}
+}
+
+// acceptDial returns a client for the session the server serves on the
+// connection it dials to ln.
+func acceptDial(t *testing.T, ln net.Listener) *jrpc2.Client {
+	t.Helper()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	cli := jrpc2.NewClient(channel.Line(conn, conn), nil)
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestDialPolicy(t *testing.T) {
+	ctx := context.Background()
+	post := &notifier.PostRequest{Body: "hello"}
+
+	type call struct {
+		method string
+		params any
+		want   jrpc2.Code
+	}
+	tests := []struct {
+		name  string
+		dial  func(addr string) *notifier.DialConfig
+		calls []call
+	}{
+		{"Default", func(addr string) *notifier.DialConfig {
+			return &notifier.DialConfig{Address: addr}
+		}, []call{
+			{"Notify.Post", post, jrpc2.NoError},
+			{"Clip.List", nil, notifier.Forbidden},
+		}},
+		{"ACL", func(addr string) *notifier.DialConfig {
+			return &notifier.DialConfig{Address: addr, ACL: map[string][]string{
+				"remote:" + addr: {"Clip.*"},
+			}}
+		}, []call{
+			{"Clip.List", nil, jrpc2.NoError},
+			{"Notify.Post", post, notifier.Forbidden},
+		}},
+		{"Auth", func(addr string) *notifier.DialConfig {
+			return &notifier.DialConfig{Address: addr, Auth: &notifier.AuthConfig{
+				Tokens: map[string]string{"proxy": "proxy-secret"},
+			}}
+		}, []call{
+			{"Clip.List", nil, notifier.Unauthorized},
+			{"Session.Auth", &notifier.AuthRequest{Token: "bogus"}, notifier.Unauthorized},
+			{"Session.Auth", &notifier.AuthRequest{Token: "proxy-secret"}, jrpc2.NoError},
+			{"Clip.List", nil, jrpc2.NoError},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer ln.Close()
+			newServer(t, &notifier.Config{
+				Dial: []*notifier.DialConfig{tc.dial(ln.Addr().String())},
+
+				// The settings for listeners do not apply to dialed sessions.
+				Auth: notifier.AuthConfig{Tokens: map[string]string{"alice": "alice-secret"}},
+			})
+			cli := acceptDial(t, ln)
+			for _, c := range tc.calls {
+				_, err := cli.Call(ctx, c.method, c.params)
+				checkCode(t, err, c.want)
+			}
+		})
+	}
+}
+
+func TestDialRemoved(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	s := newServer(t, &notifier.Config{
+		Dial: []*notifier.DialConfig{{Address: ln.Addr().String()}},
+	})
+	cli := acceptDial(t, ln)
+	if _, err := cli.Call(context.Background(), "Notify.Post", &notifier.PostRequest{Body: "hi"}); err != nil {
+		t.Fatalf("Notify.Post: unexpected error: %v", err)
+	}
+
+	// Removing the remote endpoint closes its session.
+	if err := s.Reload(&notifier.Config{}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := cli.Call(context.Background(), "Notify.Post", &notifier.PostRequest{Body: "hi"}); err == nil {
+		t.Error("Notify.Post after removal: got nil error, want an error")
+	}
+}
+
+func TestDialToken(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	newServer(t, &notifier.Config{
+		Dial: []*notifier.DialConfig{{Address: ln.Addr().String(), Token: "server-secret"}},
+	})
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	ch := channel.Line(conn, conn)
+	defer ch.Close()
+
+	// The server sends its token before the session begins.
+	data, err := ch.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	const want = `{"jsonrpc":"2.0","method":"Session.Auth","params":{"token":"server-secret"}}`
+	if got := string(data); got != want {
+		t.Errorf("First message: got %#q, want %#q", got, want)
+	}
+	cli := jrpc2.NewClient(ch, nil)
+	defer cli.Close()
+	if _, err := cli.Call(context.Background(), "Notify.Post", &notifier.PostRequest{Body: "hi"}); err != nil {
+		t.Errorf("Notify.Post: unexpected error: %v", err)
+	}
+}
+
+func TestShutdownTraffic(t *testing.T) {
+	s := notifiertest.NewNetServer(nil)
+
+	// Shut down the server while its clients are calling it in a loop.
+	var wg sync.WaitGroup
+	for range 8 {
+		cli := dial(t, s)
+		wg.Go(func() {
+			for {
+				if _, err := cli.Call(context.Background(), "Clip.List", nil); err != nil {
+					return
+				}
+			}
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Server close: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Server close did not complete")
+	}
+	wg.Wait()
+}
+
+func TestReloadConcurrent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	addr := ln.Addr().String()
+	s := newServer(t, &notifier.Config{
+		Dial: []*notifier.DialConfig{{Address: addr}},
+	})
+	acceptDial(t, ln)
+
+	// Concurrent reloads that remove the remote endpoint must not race.
+	var wg sync.WaitGroup
+	next := *s.Config
+	next.Dial = nil
+	for range 4 {
+		wg.Go(func() {
+			if err := s.Server.Reload(&next); err != nil {
+				t.Errorf("Reload: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// Adding the endpoint back does not resume dialing it.
+	if err := s.Server.Reload(s.Config); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(500 * time.Millisecond))
+	if conn, err := ln.Accept(); err == nil {
+		conn.Close()
+		t.Error("Remote was dialed after it was added back")
+	}
+}
+
+func TestServeChannelReload(t *testing.T) {
+	ctx := context.Background()
+	cfg := &notifier.Config{Auth: notifier.AuthConfig{
+		Tokens: map[string]string{"alice": "alice-secret"},
+	}}
+	reg := notifier.NewRegistry()
+	srv, err := notifier.NewServer(cfg, &notifier.ServerOptions{Registry: reg, NoListen: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Shutdown(ctx)
+
+	cch, sch := channel.Direct()
+	go srv.ServeChannel(ctx, sch, notifier.Peer{Network: "test"})
+	cli := jrpc2.NewClient(cch, nil)
+	defer cli.Close()
+
+	if _, err := cli.Call(ctx, "Session.Auth", &notifier.AuthRequest{Token: "alice-secret"}); err != nil {
+		t.Fatalf("Session.Auth: %v", err)
+	}
+	_, err = cli.Call(ctx, "Nonesuch.Method", nil)
+	checkCode(t, err, jrpc2.MethodNotFound)
+
+	// Revoking the token applies to the session.
+	next := *cfg
+	next.Auth.Tokens = map[string]string{"bob": "bob-secret"}
+	if err := srv.Reload(&next); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	_, err = cli.Call(ctx, "Nonesuch.Method", nil)
+	checkCode(t, err, notifier.Unauthorized)
+}
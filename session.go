@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// A Peer describes the client on the other end of a connection to a Server.
+type Peer struct {
+	// The network and address of the client, as reported by the connection.
+	Network string
+	Address string
+
+	// The name of the token the client authenticated with, or "" if the
+	// client has not authenticated.
+	Token string
+
+	// The name of the verified TLS client certificate, or "" if the client
+	// did not present one. The name is the common name of the certificate if
+	// that is set; see Config.ACL for the alternatives.
+	TLSSubject string
+
+	// The credentials of the client, if it is connected over a Unix-domain
+	// socket and the platform reports them; otherwise nil.
+	Cred *PeerCred
+
+	// The servers that forwarded the call, if it was forwarded, beginning
+	// with the server nearest to the original client. The other fields
+	// describe the last of these servers.
+	Via []Hop
+}
+
+// String returns a description of p for use in log messages.
+func (p Peer) String() string {
+	var sb strings.Builder
+	if p.Address == "" || p.Address == "@" {
+		sb.WriteString(p.Network)
+	} else if p.Network == "remote" {
+		sb.WriteString("remote " + p.Address)
+	} else {
+		sb.WriteString(p.Address)
+	}
+	if p.Cred != nil {
+		fmt.Fprintf(&sb, " uid=%d pid=%d", p.Cred.UID, p.Cred.PID)
+	}
+	if p.TLSSubject != "" {
+		fmt.Fprintf(&sb, " tls=%q", p.TLSSubject)
+	}
+	if p.Token != "" {
+		fmt.Fprintf(&sb, " token=%q", p.Token)
+	}
+	if len(p.Via) != 0 {
+		names := make([]string, len(p.Via))
+		for i, h := range p.Via {
+			names[i] = h.Server
+		}
+		fmt.Fprintf(&sb, " via=%s", strings.Join(names, ","))
+	}
+	return sb.String()
+}
+
+// session records the state of a single client connection.
+type session struct {
+	ep *endpoint
+	ch channel.Channel // the channel of the session; closing it ends the session
+
+	mu    sync.Mutex
+	peer  Peer
+	token string // the token the client authenticated with, or ""
+}
+
+func (s *session) Peer() Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peer
+}
+
+type sessionKey struct{}
+
+// PeerFromContext returns the peer whose request is being handled in ctx.  It
+// returns nil if ctx does not belong to a request handled by a Server.
+func PeerFromContext(ctx context.Context) *Peer {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		p := s.Peer()
+		return &p
+	}
+	return nil
+}
+
+// sessionService is the name of the service implemented by the server itself
+// for each connection. Plugins may not use this name.
+const sessionService = "Session"
+
+// AuthTokens returns the tokens accepted by the configuration, mapping each
+// token to its name. The tokens include those in c.Auth.Tokens, and those read
+// from c.Auth.TokenFile if it is set.
+//
+// Each non-blank line of the token file has the form "name token"; lines
+// beginning with "#" are ignored.
+func (c *Config) AuthTokens() (map[string]string, error) {
+	tokens := make(map[string]string)
+	add := func(name, token string) error {
+		if token == "" {
+			return fmt.Errorf("empty token for %q", name)
+		} else if old, ok := tokens[token]; ok {
+			return fmt.Errorf("duplicate token for %q and %q", old, name)
+		}
+		tokens[token] = name
+		return nil
+	}
+	for name, token := range c.Auth.Tokens {
+		if err := add(name, token); err != nil {
+			return nil, err
+		}
+	}
+	if c.Auth.TokenFile == "" {
+		return tokens, nil
+	}
+	path := os.ExpandEnv(c.Auth.TokenFile)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: invalid token line", path, ln)
+		} else if err := add(fields[0], fields[1]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, ln, err)
+		}
+	}
+	return tokens, sc.Err()
+}
+
+// checkToken reports the name of token in tokens, using a comparison that
+// does not depend on which token matches.
+func checkToken(tokens map[string]string, token string) (string, bool) {
+	var name string
+	var found bool
+	for want, who := range tokens {
+		if subtle.ConstantTimeCompare([]byte(want), []byte(token)) == 1 {
+			name, found = who, true
+		}
+	}
+	return name, found
+}
+
+// errUnauthorized is reported for calls on a connection that has not
+// authenticated, when the server requires authentication.
+var errUnauthorized = jrpc2.Errorf(Unauthorized, "authentication required")
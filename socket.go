@@ -0,0 +1,168 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// probeTimeout bounds the time spent checking whether a server is listening
+// on an existing socket.
+const probeTimeout = 2 * time.Second
+
+// listenUnix listens on the Unix-domain socket at path. It holds a lock file
+// next to the socket while the listener is open, so that only one server uses
+// the socket at a time. An existing socket is removed only if no server
+// answers on it. An abstract socket, whose path begins with "@", has no lock.
+//
+// The socket is created accessible only to the current user, so that no other
+// user can connect before the caller has set its permissions. listenUnix also
+// returns the mode the socket would have had under the process umask. To do
+// this without changing the umask, which would affect other goroutines, the
+// socket is bound in a new private directory and then moved into place.
+func listenUnix(path string) (net.Listener, os.FileMode, error) {
+	if strings.HasPrefix(path, "@") {
+		ln, err := net.Listen("unix", path)
+		return ln, 0, err
+	}
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := removeStaleSocket(path); err != nil {
+		lock.Close()
+		return nil, 0, err
+	}
+	ln, mode, err := listenPrivate(path)
+	if err != nil {
+		lock.Close()
+		return nil, 0, err
+	}
+	return &lockedListener{Listener: ln, path: path, lock: lock}, mode, nil
+}
+
+// listenPrivate listens on a Unix-domain socket in a new directory accessible
+// only to the current user, restricts the socket to the current user, and
+// then moves it to path. It returns the listener and the mode the socket had
+// when it was created. Closing the listener does not remove the socket.
+func listenPrivate(path string) (*net.UnixListener, os.FileMode, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".s")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, 0, err
+	}
+	ln.SetUnlinkOnClose(false)
+	fi, err := os.Stat(tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, 0, err
+	}
+	return ln, fi.Mode().Perm(), nil
+}
+
+// lockFile opens and locks the file at path, and records the ID of the
+// current process in it. It reports an error if the file is locked by
+// another process.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		f.Close()
+		msg := fmt.Sprintf("socket is locked by another server (%s)", path)
+		if data, _ := os.ReadFile(path); len(data) != 0 {
+			msg += ", pid " + strings.TrimSpace(string(data))
+		}
+		return nil, errors.New(msg)
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// removeStaleSocket removes the socket at path if it exists and no server is
+// listening on it. It reports an error if a server is listening, or if path
+// exists but is not a socket.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if fi.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%q exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, probeTimeout)
+	if err != nil {
+		// Nothing is listening, so the socket is stale.
+		return os.Remove(path)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	cli := jrpc2.NewClient(channel.Line(conn, conn), nil)
+	defer cli.Close()
+	var info jrpc2.ServerInfo
+	if err := cli.CallResult(ctx, "rpc.serverInfo", nil, &info); err == nil {
+		return fmt.Errorf("a server is already listening on %q (started %s)",
+			path, info.StartTime.Format(time.RFC3339))
+	}
+	return fmt.Errorf("another process is listening on %q", path)
+}
+
+// A lockedListener is a net.Listener on the socket at path that removes the
+// socket and releases a lock file when it is closed.
+type lockedListener struct {
+	net.Listener
+	path string
+	lock *os.File
+
+	once sync.Once
+	err  error
+}
+
+// Addr returns the address of the socket, which was bound at another path
+// before it was moved into place.
+func (l *lockedListener) Addr() net.Addr { return &net.UnixAddr{Name: l.path, Net: "unix"} }
+
+// Close closes the listener. Only the first call has any effect, since once
+// the lock is released the socket may belong to another server.
+func (l *lockedListener) Close() error {
+	l.once.Do(func() {
+		l.err = l.Listener.Close()
+		os.Remove(l.path)
+		l.lock.Close()
+	})
+	return l.err
+}
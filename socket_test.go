@@ -0,0 +1,145 @@
+//go:build unix
+
+package notifier
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+func TestUIDAllowed(t *testing.T) {
+	self := os.Getuid()
+	other := self + 1000
+	tests := []struct {
+		name  string
+		allow []int
+		cred  *PeerCred
+		want  bool
+	}{
+		{"Unrestricted", nil, nil, true},
+		{"UnknownPeer", []int{other}, nil, false},
+		{"Listed", []int{other}, &PeerCred{UID: other}, true},
+		{"SameUser", []int{other}, &PeerCred{UID: self}, true},
+		{"NotListed", []int{other}, &PeerCred{UID: other + 1}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := uidAllowed(tc.allow, tc.cred); got != tc.want {
+				t.Errorf("uidAllowed(%v, %+v): got %v, want %v", tc.allow, tc.cred, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnixPeerCred(t *testing.T) {
+	ln, err := ListenPrivate(filepath.Join(t.TempDir(), "cred.sock"))
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	cli, err := net.Dial("unix", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer cli.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer conn.Close()
+
+	cred, err := unixPeerCred(conn)
+	if err != nil {
+		t.Fatalf("unixPeerCred: %v", err)
+	} else if cred == nil {
+		t.Skip("Peer credentials are not supported on this platform")
+	}
+	if cred.UID != os.Getuid() || cred.PID != os.Getpid() {
+		t.Errorf("unixPeerCred: got %+v, want uid %d pid %d", cred, os.Getuid(), os.Getpid())
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		listen func(string) (net.Listener, error)
+		want   os.FileMode
+	}{
+		{"Listen", Listen, 0755},
+		{"ListenPrivate", ListenPrivate, 0600},
+		{"Configured", func(path string) (net.Listener, error) {
+			ep, err := listenEndpoint(&Config{Address: path, Socket: SocketConfig{Mode: "0660"}}, nil)
+			if err != nil {
+				return nil, err
+			}
+			return ep.ln, nil
+		}, 0660},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".sock")
+			ln, err := tc.listen(path)
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer ln.Close()
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if got := fi.Mode().Perm(); got != tc.want {
+				t.Errorf("Socket mode: got %04o, want %04o", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.sock")
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if got := ln.Addr().String(); got != path {
+		t.Errorf("Addr: got %q, want %q", got, path)
+	}
+
+	// Only the socket and its lock remain in the directory.
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, e := range ents {
+		names = append(names, e.Name())
+	}
+	if want := []string{"test.sock", "test.sock.lock"}; !slices.Equal(names, want) {
+		t.Errorf("Directory contents: got %q, want %q", names, want)
+	}
+
+	// Closing the listener removes the socket, and closing it again does not
+	// disturb a new server on the same path.
+	ln.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Socket after close: got %v, want it removed", err)
+	}
+	next, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen again: %v", err)
+	}
+	defer next.Close()
+	ln.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("Socket of new listener: %v", err)
+	}
+}
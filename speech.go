@@ -0,0 +1,212 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"bitbucket.org/creachadair/shell"
+	"github.com/creachadair/jrpc2"
+)
+
+// A Speaker is a backend that speaks text aloud to the user.
+type Speaker interface {
+	// Speak reads text aloud using the specified voice. An empty voice selects
+	// the default voice of the backend.
+	Speak(ctx context.Context, text, voice string) error
+}
+
+// Speaker returns the speech backend selected by the configuration.  If
+// c.Notify.Speaker is set, it is used; otherwise a new backend is created as
+// specified by c.Notify.SpeechBackend. In either case, voice names are mapped
+// through c.Notify.Voices before they are passed to the backend.
+func (c *Config) Speaker() (Speaker, error) {
+	s := c.Notify.Speaker
+	if s == nil {
+		var err error
+		s, err = c.newSpeaker()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Notify.Voices) == 0 {
+		return s, nil
+	}
+	return voiceMap{Speaker: s, voices: c.Notify.Voices}, nil
+}
+
+func (c *Config) newSpeaker() (Speaker, error) {
+	backend := c.Notify.SpeechBackend
+	if backend == "" && c.Notify.SpeechCommand != "" {
+		backend = "command"
+	}
+	switch backend {
+	case "", "say":
+		return commandSpeaker{"say", "-v", "{voice}"}, nil
+	case "espeak-ng":
+		return commandSpeaker{"espeak-ng", "-v", "{voice}", "--stdin"}, nil
+	case "festival":
+		return festivalSpeaker{}, nil
+	case "piper":
+		models := make(map[string]bool)
+		for _, model := range c.Notify.Voices {
+			models[model] = true
+		}
+		return piperSpeaker{models: models}, nil
+	case "command":
+		args, ok := shell.Split(c.Notify.SpeechCommand)
+		if !ok || len(args) == 0 {
+			return nil, fmt.Errorf("invalid speech command %q", c.Notify.SpeechCommand)
+		}
+		return commandSpeaker(args), nil
+	default:
+		return nil, fmt.Errorf("unknown speech backend %q", backend)
+	}
+}
+
+// voiceMap wraps a Speaker to translate voice names before speaking.
+// Voices that do not appear in the map are passed through unmodified.
+type voiceMap struct {
+	Speaker
+	voices map[string]string
+}
+
+func (v voiceMap) Speak(ctx context.Context, text, voice string) error {
+	if alt, ok := v.voices[voice]; ok {
+		voice = alt
+	}
+	return v.Speaker.Speak(ctx, text, voice)
+}
+
+// commandSpeaker speaks text by running a command with the text on stdin.
+// Each occurrence of "{voice}" in an argument is replaced by the voice name.
+// If the voice name is empty, an argument consisting only of "{voice}" is
+// removed along with the flag that precedes it, if any.
+type commandSpeaker []string
+
+func (c commandSpeaker) Speak(ctx context.Context, text, voice string) error {
+	var args []string
+	for _, arg := range c[1:] {
+		if arg == "{voice}" && voice == "" {
+			if n := len(args); n != 0 && strings.HasPrefix(args[n-1], "-") {
+				args = args[:n-1]
+			}
+			continue
+		}
+		args = append(args, strings.ReplaceAll(arg, "{voice}", voice))
+	}
+	cmd := exec.CommandContext(ctx, c[0], args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// festivalSpeaker speaks text using the Festival speech synthesizer.
+// Voice names are Festival voice names without the "voice_" prefix.
+type festivalSpeaker struct{}
+
+// festivalVoice matches the voice names accepted by festivalSpeaker.  The
+// name is spliced into a Scheme program, so nothing else is allowed.
+var festivalVoice = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func (festivalSpeaker) Speak(ctx context.Context, text, voice string) error {
+	var program strings.Builder
+	if voice != "" {
+		if !festivalVoice.MatchString(voice) {
+			return jrpc2.Errorf(jrpc2.InvalidParams, "invalid voice name %q", voice)
+		}
+		fmt.Fprintf(&program, "(voice_%s)\n", voice)
+	}
+	fmt.Fprintf(&program, "(SayText %s)\n", schemeString(text))
+	cmd := exec.CommandContext(ctx, "festival", "--pipe")
+	cmd.Stdin = strings.NewReader(program.String())
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// piperSpeaker speaks text using the Piper neural synthesizer, playing the
+// resulting audio with aplay. Voice names are paths to Piper voice models,
+// and only the models named in the configured voice map may be used.
+type piperSpeaker struct {
+	models map[string]bool
+}
+
+func (p piperSpeaker) Speak(ctx context.Context, text, voice string) error {
+	if voice == "" {
+		return errors.New("the piper backend requires a voice model")
+	} else if !p.models[voice] {
+		return jrpc2.Errorf(jrpc2.InvalidParams, "unknown voice %q", voice)
+	}
+	synth := exec.CommandContext(ctx, "piper", "--model", voice, "--output-raw")
+	synth.Stdin = strings.NewReader(text)
+	synth.Stderr = os.Stderr
+	play := exec.CommandContext(ctx, "aplay", "-q", "-r", "22050", "-f", "S16_LE", "-t", "raw", "-")
+	play.Stderr = os.Stderr
+
+	// Start the player first, so that the synthesizer does not block writing
+	// audio that nobody reads.
+	audio, out, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	play.Stdin = audio
+	synth.Stdout = out
+	if err := play.Start(); err != nil {
+		audio.Close()
+		out.Close()
+		return err
+	}
+	audio.Close()
+	if err := synth.Start(); err != nil {
+		out.Close()
+		play.Process.Kill()
+		play.Wait()
+		return err
+	}
+	out.Close()
+	perr := play.Wait()
+	if err := synth.Wait(); err != nil {
+		return err
+	}
+	return perr
+}
+
+// schemeString returns s as a Scheme string literal.
+func schemeString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// An Utterance records a single call to the Speak method of a
+// RecordingSpeaker.
+type Utterance struct {
+	Text  string
+	Voice string
+}
+
+// RecordingSpeaker is a Speaker that records the text it is asked to speak
+// without producing any sound. The zero value is ready for use.
+type RecordingSpeaker struct {
+	mu   sync.Mutex
+	said []Utterance
+}
+
+// Speak implements the Speaker interface.
+func (r *RecordingSpeaker) Speak(_ context.Context, text, voice string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.said = append(r.said, Utterance{Text: text, Voice: voice})
+	return nil
+}
+
+// Utterances returns a copy of the utterances recorded by r, in order.
+func (r *RecordingSpeaker) Utterances() []Utterance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Utterance(nil), r.said...)
+}
@@ -0,0 +1,38 @@
+package notifier_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/notifier"
+)
+
+func TestSpeakerVoices(t *testing.T) {
+	tests := []struct {
+		backend string
+		voices  map[string]string
+		voice   string
+	}{
+		{"festival", nil, "kal_diphone) (system \"true\""},
+		{"festival", nil, "a b"},
+		{"festival", map[string]string{"alt": "x)(y"}, "alt"},
+		{"piper", nil, "/etc/passwd"},
+		{"piper", map[string]string{"amy": "/models/amy.onnx"}, "bob"},
+	}
+	for _, tc := range tests {
+		var cfg notifier.Config
+		cfg.Notify.SpeechBackend = tc.backend
+		cfg.Notify.Voices = tc.voices
+		s, err := cfg.Speaker()
+		if err != nil {
+			t.Fatalf("Speaker %q: %v", tc.backend, err)
+		}
+
+		// The voice is rejected before the synthesizer is started.
+		err = s.Speak(context.Background(), "hello", tc.voice)
+		if got := jrpc2.ErrorCode(err); got != jrpc2.InvalidParams {
+			t.Errorf("%s: Speak voice %q: got %v, want InvalidParams", tc.backend, tc.voice, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package notifier
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// handshakeTimeout bounds the time allowed for a client to complete a TLS
+// handshake after connecting.
+const handshakeTimeout = 10 * time.Second
+
+// ServerTLS returns the TLS settings for the server selected by c, or nil if
+// TLS is not enabled.
+func (c *Config) ServerTLS() (*tls.Config, error) {
+	t := c.TLS
+	if t.CertFile == "" && t.KeyFile == "" {
+		if t.ClientCAFile != "" {
+			return nil, errors.New("clientCAFile requires certFile and keyFile")
+		}
+		return nil, nil
+	} else if t.CertFile == "" || t.KeyFile == "" {
+		return nil, errors.New("certFile and keyFile must both be set")
+	}
+	cert, err := tls.LoadX509KeyPair(os.ExpandEnv(t.CertFile), os.ExpandEnv(t.KeyFile))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.ClientCAFile != "" {
+		pool, err := loadCertPool(t.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// loadCertPool returns a pool of the PEM certificates in the file at path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", path)
+	}
+	return pool, nil
+}
+
+// clientTLS returns the TLS settings for a client connecting to addr, or nil
+// if TLS is not enabled. TLS is enabled if a CA, client certificate, or
+// server name is set by flag or environment.
+func clientTLS(addr string) (*tls.Config, error) {
+	t := ClientTLSConfig{
+		CAFile:     tlsCA,
+		CertFile:   tlsCert,
+		KeyFile:    tlsKey,
+		ServerName: tlsServerName,
+	}
+	if t == (ClientTLSConfig{}) {
+		return nil, nil
+	}
+	return t.config(addr)
+}
+
+// config returns the TLS settings described by t for a connection to addr.
+// Settings that are empty have their default values, so an empty t verifies
+// the server with the system roots, and presents no client certificate.
+func (t ClientTLSConfig) config(addr string) (*tls.Config, error) {
+	if t.KeyFile != "" && t.CertFile == "" {
+		return nil, errors.New("a TLS key requires a certificate")
+	}
+	cfg := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cfg.ServerName = host
+		}
+	}
+	if t.CAFile != "" {
+		pool, err := loadCertPool(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		key := t.KeyFile
+		if key == "" {
+			key = t.CertFile // allow the key and certificate in one file
+		}
+		cert, err := tls.LoadX509KeyPair(os.ExpandEnv(t.CertFile), os.ExpandEnv(key))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// tlsSubject completes the handshake on conn if it is a TLS connection, and
+// returns the name of the verified client certificate, if any, as described by
+// certName.
+func tlsSubject(conn net.Conn) (string, error) {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	if !tc.ConnectionState().HandshakeComplete {
+		tc.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			return "", err
+		}
+		tc.SetDeadline(time.Time{})
+	}
+	if chains := tc.ConnectionState().VerifiedChains; len(chains) != 0 {
+		return certName(chains[0][0]), nil
+	}
+	return "", nil
+}
+
+// certName returns the name of cert: its common name if that is set, or else
+// its first DNS name, email address, or URI, or else its full subject. A
+// certificate with none of these is named by the SHA-256 digest of its
+// contents, so that the name is never empty.
+func certName(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) != 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) != 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) != 0:
+		return cert.URIs[0].String()
+	}
+	if dn := cert.Subject.String(); dn != "" {
+		return dn
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(cert.Raw))
+}
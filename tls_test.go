@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCertName(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.com/build")
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{"CommonName", &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "alice"},
+			DNSNames: []string{"alice.example.com"},
+		}, "alice"},
+		{"DNSName", &x509.Certificate{
+			DNSNames:       []string{"build.example.com"},
+			EmailAddresses: []string{"build@example.com"},
+		}, "build.example.com"},
+		{"Email", &x509.Certificate{
+			EmailAddresses: []string{"build@example.com"},
+		}, "build@example.com"},
+		{"URI", &x509.Certificate{
+			URIs: []*url.URL{uri},
+		}, "spiffe://example.com/build"},
+		{"Subject", &x509.Certificate{
+			Subject: pkix.Name{Organization: []string{"Example"}, OrganizationalUnit: []string{"Build"}},
+		}, "OU=Build,O=Example"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := certName(tc.cert); got != tc.want {
+				t.Errorf("certName: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		got := certName(&x509.Certificate{Raw: []byte("certificate")})
+		if !strings.HasPrefix(got, "sha256:") {
+			t.Errorf("certName: got %q, want a sha256 digest", got)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package notifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// maxHops is the maximum number of servers a call may be forwarded through.
+const maxHops = 8
+
+// An UpstreamConfig describes a server to which calls are forwarded.
+type UpstreamConfig struct {
+	// The address of the upstream server, host:port for TCP or the path of a
+	// Unix-domain socket.
+	Address string
+
+	// If set, the connection uses TLS with these settings.
+	TLS *ClientTLSConfig
+
+	// If set, authenticate to the upstream server with this token.
+	Token string `notifier:"secret"`
+
+	// The services whose calls are forwarded, for example "Notify". Calls to
+	// other services are handled locally.
+	Services []string
+}
+
+// check reports an error if the settings of u are invalid.
+func (u *UpstreamConfig) check() error {
+	if len(u.Services) == 0 {
+		return errors.New("no services are forwarded")
+	} else if slices.Contains(u.Services, sessionService) {
+		return fmt.Errorf("service %q cannot be forwarded", sessionService)
+	}
+	return u.dialConfig().check()
+}
+
+func (u *UpstreamConfig) dialConfig() *DialConfig {
+	return &DialConfig{Address: u.Address, TLS: u.TLS}
+}
+
+// defaultName returns a name for a server in forwarding hops, for use when
+// the configuration does not name it. The name is the host name with a random
+// suffix, so that servers on the same host have different names.
+func defaultName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "noteserver"
+	}
+	var buf [4]byte
+	rand.Read(buf[:])
+	return host + "#" + hex.EncodeToString(buf[:])
+}
+
+// An upstream is a connection to an upstream server, which is dialed when
+// it is first needed and redialed if it is lost.
+type upstream struct {
+	cfg *UpstreamConfig
+
+	mu      sync.Mutex
+	cli     *jrpc2.Client
+	dialing chan struct{} // closed when the dial in progress ends, or nil
+	closed  bool
+}
+
+// forwards reports whether u forwards calls to method.
+func (u *upstream) forwards(method string) bool {
+	svc, _, _ := strings.Cut(method, ".")
+	return slices.Contains(u.cfg.Services, svc)
+}
+
+// client returns a client connected to the upstream server, dialing it if
+// there is no active connection. Only one caller dials at a time, and other
+// callers wait for its result.
+func (u *upstream) client(ctx context.Context) (*jrpc2.Client, error) {
+	for {
+		u.mu.Lock()
+		if u.closed {
+			u.mu.Unlock()
+			return nil, errors.New("connection closed")
+		} else if cli := u.cli; cli != nil && !cli.IsStopped() {
+			u.mu.Unlock()
+			return cli, nil
+		} else if wait := u.dialing; wait != nil {
+			u.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		u.dialing = done
+		u.mu.Unlock()
+
+		cli, err := u.dial(ctx)
+		u.mu.Lock()
+		u.dialing = nil
+		if err == nil && u.closed {
+			cli.Close()
+			cli, err = nil, errors.New("connection closed")
+		} else if err == nil {
+			u.cli = cli
+		}
+		u.mu.Unlock()
+		close(done)
+		return cli, err
+	}
+}
+
+// dial connects and authenticates to the upstream server.
+func (u *upstream) dial(ctx context.Context) (*jrpc2.Client, error) {
+	conn, err := dialRemote(ctx, u.cfg.dialConfig())
+	if err != nil {
+		return nil, err
+	}
+	cli := jrpc2.NewClient(channel.Line(conn, conn), nil)
+	if u.cfg.Token != "" {
+		if _, err := cli.Call(ctx, "Session.Auth", &AuthRequest{Token: u.cfg.Token}); err != nil {
+			cli.Close()
+			return nil, fmt.Errorf("authenticating: %w", err)
+		}
+	}
+	return cli, nil
+}
+
+// call forwards req to the upstream server and returns its result.
+func (u *upstream) call(ctx context.Context, req *ForwardRequest) (json.RawMessage, error) {
+	cli, err := u.client(ctx)
+	if err != nil {
+		return nil, jrpc2.Errorf(jrpc2.SystemError, "upstream %q: %v", u.cfg.Address, err)
+	}
+	var result json.RawMessage
+	if err := cli.CallResult(ctx, "Session.Forward", req, &result); err != nil {
+		var jerr *jrpc2.Error
+		if errors.As(err, &jerr) {
+			return nil, jerr
+		}
+		return nil, jrpc2.Errorf(jrpc2.SystemError, "upstream %q: %v", u.cfg.Address, err)
+	}
+	return result, nil
+}
+
+// close closes the connection to the upstream server, if any. After close,
+// calls to u fail.
+func (u *upstream) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.cli != nil {
+		u.cli.Close()
+		u.cli = nil
+	}
+}
+
+// newUpstream returns an upstream for the settings of cfg, or nil if cfg does
+// not forward calls.
+func newUpstream(cfg *Config) *upstream {
+	if cfg.Upstream == nil {
+		return nil
+	}
+	return &upstream{cfg: cfg.Upstream}
+}
+
+// upstream returns the upstream to which s forwards calls to method, or nil
+// if s handles them itself.
+func (s *Server) upstream(method string) *upstream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.up != nil && s.up.forwards(method) {
+		return s.up
+	}
+	return nil
+}
+
+// forward returns a handler that forwards calls to method to up, recording
+// the server of d as a hop.
+func (d dispatcher) forward(up *upstream, method string) jrpc2.Handler {
+	return func(ctx context.Context, req *jrpc2.Request) (any, error) {
+		p := d.sess.Peer()
+		client := p
+		client.Via = nil
+		return up.call(ctx, &ForwardRequest{
+			Method: method,
+			Params: json.RawMessage(req.ParamString()),
+			Via:    append(slices.Clip(p.Via), Hop{Server: d.s.name(), Client: client.String()}),
+		})
+	}
+}
+
+// forwarded implements the Session.Forward method, for clients with one of
+// the downstream identities of the configuration. The call is handled as if
+// the client had called the original method, with the hops of the request
+// recorded in its peer, and may be forwarded again.
+func (d dispatcher) forwarded(ctx context.Context, req *ForwardRequest) (any, error) {
+	if !d.authorized() {
+		return nil, errUnauthorized
+	} else if p := d.sess.Peer(); !d.downstream(p) {
+		log.Printf("Client %s is not permitted to forward calls", p)
+		return nil, jrpc2.Errorf(Forbidden, "client may not forward calls")
+	}
+	if svc, _, _ := strings.Cut(req.Method, "."); svc == sessionService || strings.HasPrefix(req.Method, "rpc.") {
+		return nil, jrpc2.Errorf(jrpc2.InvalidParams, "method %q cannot be forwarded", req.Method)
+	}
+	name := d.s.name()
+	if slices.ContainsFunc(req.Via, func(h Hop) bool { return h.Server == name }) {
+		return nil, jrpc2.Errorf(jrpc2.SystemError, "forwarding loop: call has already passed through %q", name)
+	} else if len(req.Via) >= maxHops {
+		return nil, jrpc2.Errorf(jrpc2.SystemError, "call has already been forwarded %d times", len(req.Via))
+	}
+
+	p := d.sess.Peer()
+	p.Via = req.Via
+	sess := &session{ep: d.sess.ep, peer: p}
+	h := dispatcher{s: d.s, sess: sess}.handler(ctx, req.Method)
+	if h == nil {
+		return nil, jrpc2.Errorf(jrpc2.MethodNotFound, "method %q not found", req.Method)
+	}
+	inner := &jrpc2.ParsedRequest{ID: "1", Method: req.Method, Params: req.Params}
+	return h(context.WithValue(ctx, sessionKey{}, sess), inner.ToRequest())
+}
+
+// downstream reports whether p has one of the identities that may forward
+// calls to the endpoint of d.
+func (d dispatcher) downstream(p Peer) bool {
+	ids := d.s.policy(d.sess.ep).downstream
+	return slices.ContainsFunc(p.identities(), func(id string) bool {
+		return slices.Contains(ids, id)
+	})
+}
+
+// name returns the name of s in forwarding hops.
+func (s *Server) name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cfg.Name != "" {
+		return s.cfg.Name
+	}
+	return s.hopName
+}
@@ -0,0 +1,83 @@
+package notifier_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/notifier"
+)
+
+func TestForward(t *testing.T) {
+	ctx := context.Background()
+
+	// Both servers use the default name, which must differ between servers
+	// on the same host for the forwarded calls not to be taken for a loop.
+	up := newServer(t, &notifier.Config{
+		Auth: notifier.AuthConfig{Tokens: map[string]string{
+			"edge":  "edge-secret",
+			"alice": "alice-secret",
+		}},
+		Downstream: []string{"token:edge"},
+	})
+	edge := newServer(t, &notifier.Config{
+		Upstream: &notifier.UpstreamConfig{
+			Address:  up.Addr,
+			Token:    "edge-secret",
+			Services: []string{"Notify"},
+		},
+	})
+
+	t.Run("Forwarded", func(t *testing.T) {
+		cli := dial(t, edge)
+		if _, err := cli.Call(ctx, "Notify.Post", &notifier.PostRequest{Body: "hello"}); err != nil {
+			t.Fatalf("Notify.Post: unexpected error: %v", err)
+		}
+		if got := up.Poster.Posted(); len(got) != 1 || got[0].Body != "hello" {
+			t.Errorf("Upstream posted %+v, want one notification", got)
+		}
+		if got := edge.Poster.Posted(); len(got) != 0 {
+			t.Errorf("Downstream posted %+v, want none", got)
+		}
+	})
+	t.Run("Local", func(t *testing.T) {
+		edge.Clipboard.SetClipboard(ctx, []byte("local"))
+		var data []byte
+		if err := dial(t, edge).CallResult(ctx, "Clip.Get", &notifier.ClipGetRequest{}, &data); err != nil {
+			t.Fatalf("Clip.Get: unexpected error: %v", err)
+		} else if string(data) != "local" {
+			t.Errorf("Clip.Get: got %q, want %q", data, "local")
+		}
+	})
+	t.Run("NotDownstream", func(t *testing.T) {
+		cli := authenticate(t, up, "alice-secret")
+		_, err := cli.Call(ctx, "Session.Forward", &notifier.ForwardRequest{
+			Method: "Notify.Post",
+			Params: []byte(`{"body":"spoofed"}`),
+			Via:    []notifier.Hop{{Server: "elsewhere", Client: "mallory"}},
+		})
+		checkCode(t, err, notifier.Forbidden)
+	})
+	t.Run("Loop", func(t *testing.T) {
+		// A server that forwards to itself sees its own name in the hops.
+		s := newServer(t, &notifier.Config{
+			Auth:       notifier.AuthConfig{Tokens: map[string]string{"self": "self-secret"}},
+			Downstream: []string{"token:self"},
+		})
+		cfg := *s.Config
+		cfg.Upstream = &notifier.UpstreamConfig{
+			Address:  s.Addr,
+			Token:    "self-secret",
+			Services: []string{"Notify"},
+		}
+		if err := s.Reload(&cfg); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+		cli := authenticate(t, s, "self-secret")
+		_, err := cli.Call(ctx, "Notify.Post", &notifier.PostRequest{Body: "again"})
+		checkCode(t, err, jrpc2.SystemError)
+		if got := s.Poster.Posted(); len(got) != 0 {
+			t.Errorf("Posted %+v, want none", got)
+		}
+	})
+}
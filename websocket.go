@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/coder/websocket"
+)
+
+// wsMaxMessage is the largest message accepted from a WebSocket client.
+const wsMaxMessage = 16 << 20
+
+// acceptWebSocket completes a WebSocket handshake for r and returns a channel
+// that exchanges each message as a single text message. If the request is not
+// a valid WebSocket handshake, acceptWebSocket writes an error response to w
+// and reports an error.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsChannel, error) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		// The origin of the request has already been checked against the
+		// origins allowed by the listener.
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(wsMaxMessage)
+	return &wsChannel{conn: conn}, nil
+}
+
+// A wsChannel is a channel.Channel that exchanges messages over a WebSocket
+// connection from the server side.
+type wsChannel struct {
+	conn *websocket.Conn
+}
+
+// Send implements part of channel.Channel.
+func (c *wsChannel) Send(msg []byte) error {
+	return c.conn.Write(context.Background(), websocket.MessageText, msg)
+}
+
+// Recv implements part of channel.Channel. It reports io.EOF when the client
+// closes the connection normally.
+func (c *wsChannel) Recv() ([]byte, error) {
+	_, msg, err := c.conn.Read(context.Background())
+	switch websocket.CloseStatus(err) {
+	case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+		return nil, io.EOF
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	return msg, err
+}
+
+// Close implements part of channel.Channel.
+func (c *wsChannel) Close() error {
+	return c.conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,63 @@
+package notifier_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/coder/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	s := newHTTPServer(t)
+	ctx := context.Background()
+	url := "ws://" + s.Addr + "/ws"
+
+	t.Run("BadToken", func(t *testing.T) {
+		_, rsp, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+			HTTPHeader: http.Header{"Authorization": {"Bearer bogus"}},
+		})
+		if err == nil {
+			t.Fatal("Dial: got nil error, want an error")
+		} else if rsp == nil || rsp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Dial: got response %v, want status %d", rsp, http.StatusUnauthorized)
+		}
+	})
+
+	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": {"Bearer bob-secret"},
+			"Origin":        {"chrome-extension://ok"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.CloseNow()
+
+	// Each message is exchanged as a single text message, and the session
+	// persists across calls.
+	for _, tc := range []struct {
+		req, want string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"Clip.List"}`, `{"jsonrpc":"2.0","id":1,"result":["active"]}`},
+		{`{"jsonrpc":"2.0","id":2,"method":"Notify.Post","params":{"body":"x"}}`,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-29996,"message":"access to \"Notify.Post\" is not permitted"}}`},
+	} {
+		if err := conn.Write(ctx, websocket.MessageText, []byte(tc.req)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		mtype, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		} else if mtype != websocket.MessageText {
+			t.Errorf("Read: got message type %v, want text", mtype)
+		}
+		if got := string(data); got != tc.want {
+			t.Errorf("Response: got %#q, want %#q", got, tc.want)
+		}
+	}
+	if err := conn.Close(websocket.StatusNormalClosure, ""); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}